@@ -1,10 +1,15 @@
 package api
 
 import (
+	"log"
+
 	"github.com/gin-gonic/gin"
 	"qianmianyao/MistChat-Server/internal/handler/chat"
 	"qianmianyao/MistChat-Server/internal/handler/hello"
+	"qianmianyao/MistChat-Server/internal/middleware"
 	"qianmianyao/MistChat-Server/internal/websocket"
+	"qianmianyao/MistChat-Server/pkg/config"
+	"qianmianyao/MistChat-Server/pkg/storage"
 )
 
 // SetupRouter 设置路由组
@@ -22,14 +27,59 @@ func SetupRouter(r *gin.Engine) {
 
 // RegisterWebSocketRoutes 使用提供的Gin引擎注册WebSocket路由
 func RegisterWebSocketRoutes(r *gin.RouterGroup) {
-	hub := websocket.NewHub()
+	attachmentStorage, err := storage.New(config.GetConfig().Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize attachment storage: %v", err)
+	}
+	hub := websocket.NewHub(attachmentStorage)
 	go hub.Run()
-	r.POST("/register", chat.NewWebSockerRouter().Register)
-	r.GET("/connect", chat.NewWebSockerRouter().WsHandler(hub))
-	r.POST("/check_room_password", chat.NewWebSockerRouter().CheckRoomPasswordRequired)
-	r.POST("/join_room", chat.NewWebSockerRouter().JoinRoom)
-	r.POST("/create_room", chat.NewWebSockerRouter().CreateRoom)
-	r.POST("/save_signal_prekey_bundle", chat.NewWebSockerRouter().SaveSignalKey)
-	r.GET("/get_signal_prekey_bundle/:cuid", chat.NewWebSockerRouter().GetSignalKey)
-	r.GET("/get_users_rooms", chat.NewWebSockerRouter().GetUsersRooms)
+	go hub.RunSignedPreKeyMonitor()
+	go hub.RunAttachmentJanitor()
+	router := chat.NewWebSockerRouter(hub, attachmentStorage)
+	r.POST("/register", router.Register)
+	r.POST("/refresh_token", router.RefreshToken)
+	// 下载链接自带签名，无需访问令牌
+	r.GET("/attachments/:id/download", router.DownloadAttachment)
+
+	// 以下路由需要有效的访问令牌
+	authed := r.Group("", middleware.Auth())
+	{
+		authed.GET("/connect", router.WsHandler)
+		authed.POST("/register_device", router.RegisterDevice)
+		authed.GET("/get_user_devices/:cuid", router.GetUserDevices)
+		authed.POST("/check_room_password", router.CheckRoomPasswordRequired)
+		authed.POST("/join_room", router.JoinRoom)
+		authed.POST("/create_room", router.CreateRoom)
+		authed.GET("/rooms/:uuid/members", router.GetRoomMembers)
+		authed.GET("/rooms/:uuid/messages", router.GetRoomMessages)
+		authed.GET("/rooms/:uuid/threads/unread", router.GetThreadUnread)
+		authed.POST("/leave_room", router.LeaveRoom)
+		authed.POST("/rename_room", router.RenameRoom)
+		authed.POST("/archive_room", router.ArchiveRoom)
+		authed.POST("/unarchive_room", router.UnarchiveRoom)
+		authed.POST("/delete_room", router.DeleteRoom)
+		authed.POST("/kick_member", router.KickMember)
+		authed.POST("/ban_member", router.BanMember)
+		authed.POST("/unban_member", router.UnbanMember)
+		authed.POST("/promote_member", router.PromoteMember)
+		authed.POST("/demote_member", router.DemoteMember)
+		authed.POST("/transfer_ownership", router.TransferOwnership)
+		authed.POST("/create_invite", router.CreateInvite)
+		authed.POST("/join_by_invite", router.JoinByInvite)
+		authed.GET("/list_invites", router.ListInvites)
+		authed.POST("/revoke_invite", router.RevokeInvite)
+		authed.POST("/save_signal_prekey_bundle", router.SaveSignalKey)
+		authed.GET("/get_signal_prekey_bundle/:cuid", router.GetSignalKey)
+		authed.POST("/upload_signal_prekeys", router.UploadPreKeys)
+		authed.GET("/signal_prekey_count", router.GetPreKeyCount)
+		authed.POST("/upload_signed_prekey", router.UploadSignedPreKey)
+		authed.POST("/replace_identity_key", router.ReplaceIdentityKey)
+		authed.GET("/sender_key_status", router.GetSenderKeyStatus)
+		authed.GET("/get_users_rooms", router.GetUsersRooms)
+		authed.POST("/presence_settings", router.UpdatePresenceSettings)
+		authed.POST("/attachments", router.CreateAttachment)
+		authed.GET("/attachments/:id", router.GetAttachmentUpload)
+		authed.PUT("/attachments/:id/parts/:part", router.UploadAttachmentPart)
+		authed.GET("/attachments/:id/url", router.GetAttachmentURL)
+	}
 }
@@ -0,0 +1,421 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"qianmianyao/MistChat-Server/internal/middleware"
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/models/entity"
+	"qianmianyao/MistChat-Server/internal/services/chat"
+	"qianmianyao/MistChat-Server/pkg/config"
+	"qianmianyao/MistChat-Server/pkg/encryption"
+	"qianmianyao/MistChat-Server/pkg/global"
+	"qianmianyao/MistChat-Server/pkg/media"
+	"qianmianyao/MistChat-Server/pkg/utils"
+)
+
+// attachmentIDPrefix 附件 ID 前缀
+const attachmentIDPrefix = "a_"
+
+func toAttachmentUpload(attachment entity.Attachment) dot.AttachmentUpload {
+	return dot.AttachmentUpload{
+		AttachmentID: attachment.AttachmentID,
+		Size:         attachment.Size,
+		Received:     attachment.Received,
+		ChunkSize:    attachment.ChunkSize,
+		NextPart:     attachment.Parts,
+		Completed:    attachment.CompletedAt != nil,
+		Width:        attachment.Width,
+		Height:       attachment.Height,
+	}
+}
+
+// attachmentResource 附件下载链接签名覆盖的资源名
+func attachmentResource(attachmentID string) string {
+	return "attachments/" + attachmentID
+}
+
+// CreateAttachment 登记一个附件的分片上传。
+// @Summary 登记附件上传
+// @Description 为客户端加密后的附件登记分片上传，返回附件 ID 与分片大小。附件大小与用户附件总量受配置限制，只有房间成员可以向房间上传附件。
+// @Description 可同时登记一个缩略图，缩略图作为独立附件使用相同的分片接口上传。标记为 plaintext 的附件在上传完成时会校验 MIME 类型与图片、MP4 及 QuickTime 视频的尺寸。
+// @Description 登记后超过 upload_ttl 仍未完成的上传会连同缩略图一并清理。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param data body dot.CreateAttachmentData true "房间UUID、密文总字节数、MIME 类型、尺寸与可选的缩略图"
+// @Success 200 {object} utils.Response{data=dot.AttachmentUpload} "上传进度"
+// @Failure 400 {object} utils.Response "请求参数错误、附件过大或超出配额"
+// @Failure 403 {object} utils.Response "不在房间内"
+// @Router /chat/attachments [post]
+func (w *WebSockerRouter) CreateAttachment(c *gin.Context) {
+	var data dot.CreateAttachmentData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	uuid := middleware.CurrentUser(c).UUID
+	if w.chatFind.IsTheUserIsInTheRoom(uuid, data.RoomUUID) == chat.NotInRoom || w.chatFind.IsBanned(uuid, data.RoomUUID) {
+		utils.Forbidden(c, "不在房间内")
+		return
+	}
+	if w.chatFind.IsRoomArchived(data.RoomUUID) {
+		utils.Forbidden(c, "房间已归档")
+		return
+	}
+
+	storageConfig := config.GetConfig().Storage
+	if data.Size > storageConfig.MaxFileSize {
+		utils.Error(c, "附件过大")
+		return
+	}
+	if data.Thumbnail != nil && data.Thumbnail.Size > storageConfig.MaxThumbnailSize {
+		utils.Error(c, "缩略图过大")
+		return
+	}
+
+	attachmentID, err := encryption.GenerateUID(attachmentIDPrefix)
+	if err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	attachment := entity.Attachment{
+		AttachmentID: attachmentID,
+		OwnerUUID:    uuid,
+		RoomUUID:     data.RoomUUID,
+		MimeType:     data.MimeType,
+		Size:         data.Size,
+		ChunkSize:    storageConfig.ChunkSize,
+		Plaintext:    data.Plaintext,
+		Width:        data.Width,
+		Height:       data.Height,
+	}
+	attachments := []*entity.Attachment{&attachment}
+	var thumbnail entity.Attachment
+	if data.Thumbnail != nil {
+		thumbnailID, err := encryption.GenerateUID(attachmentIDPrefix)
+		if err != nil {
+			utils.ErrorWithDefault(c)
+			return
+		}
+		thumbnail = entity.Attachment{
+			AttachmentID: thumbnailID,
+			OwnerUUID:    uuid,
+			RoomUUID:     data.RoomUUID,
+			MimeType:     data.Thumbnail.MimeType,
+			Size:         data.Thumbnail.Size,
+			ChunkSize:    storageConfig.ChunkSize,
+		}
+		attachment.ThumbnailID = thumbnailID
+		attachments = append(attachments, &thumbnail)
+	}
+	if err := w.chatCreate.Attachment(uuid, storageConfig.UserQuota, attachments...); err != nil {
+		if errors.Is(err, chat.ErrQuotaExceeded) {
+			utils.Error(c, "超出附件存储配额")
+			return
+		}
+		utils.ErrorWithDefault(c)
+		return
+	}
+
+	upload := toAttachmentUpload(attachment)
+	if data.Thumbnail != nil {
+		thumbnailUpload := toAttachmentUpload(thumbnail)
+		upload.Thumbnail = &thumbnailUpload
+	}
+	utils.SuccessWithDefault(c, upload)
+}
+
+// ownAttachment 获取当前用户上传的附件，附件不存在或不属于当前用户时直接写入响应并返回 false
+func (w *WebSockerRouter) ownAttachment(c *gin.Context) (entity.Attachment, bool) {
+	attachment, err := w.chatFind.Attachment(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.Error(c, "附件不存在")
+		} else {
+			utils.ErrorWithDefault(c)
+		}
+		return attachment, false
+	}
+	if attachment.OwnerUUID != middleware.CurrentUser(c).UUID {
+		utils.Forbidden(c, "没有执行该操作的权限")
+		return attachment, false
+	}
+	return attachment, true
+}
+
+// uploadPendingCompletion 判断附件的所有分片均已记录但尚未合并完成，通常是此前的合并或校验失败
+func uploadPendingCompletion(attachment entity.Attachment) bool {
+	return attachment.CompletedAt == nil && attachment.Received == attachment.Size
+}
+
+// finishAttachment 合并并校验已收齐分片的附件，失败时写入响应并返回 false
+func (w *WebSockerRouter) finishAttachment(c *gin.Context, attachment *entity.Attachment) bool {
+	if err := w.completeAttachment(c.Request.Context(), attachment); err != nil {
+		if errors.Is(err, media.ErrTypeMismatch) || errors.Is(err, media.ErrDimensionMismatch) {
+			utils.Error(c, "附件内容与声明不符")
+			return false
+		}
+		utils.ErrorWithDefault(c)
+		return false
+	}
+	return true
+}
+
+// GetAttachmentUpload 查询附件的上传进度。
+// @Summary 查询附件上传进度
+// @Description 返回已接收的字节数与下一个待上传的分片序号，上传中断后客户端据此继续上传。只有上传者可以查询。
+// @Description 分片已全部接收但此前合并失败时，查询会重新尝试合并。
+// @Tags Chat
+// @Produce json
+// @Param id path string true "附件ID"
+// @Success 200 {object} utils.Response{data=dot.AttachmentUpload} "上传进度"
+// @Failure 400 {object} utils.Response "附件不存在"
+// @Failure 403 {object} utils.Response "没有权限"
+// @Router /chat/attachments/{id} [get]
+func (w *WebSockerRouter) GetAttachmentUpload(c *gin.Context) {
+	attachment, ok := w.ownAttachment(c)
+	if !ok {
+		return
+	}
+	if uploadPendingCompletion(attachment) && !w.finishAttachment(c, &attachment) {
+		return
+	}
+	utils.SuccessWithDefault(c, toAttachmentUpload(attachment))
+}
+
+// UploadAttachmentPart 上传附件的一个分片。
+// @Summary 上传附件分片
+// @Description 请求体为分片的原始字节。分片必须按序号依次上传，除最后一片外每片大小必须等于 chunk_size；
+// @Description 重复上传已记录的分片会返回当前进度而不写入。最后一片写入后附件自动合并完成，合并失败时重新上传最后一片会重试合并；
+// @Description 明文附件的内容与声明的 MIME 类型或尺寸不符时，附件连同缩略图一并删除。
+// @Tags Chat
+// @Accept octet-stream
+// @Produce json
+// @Param id path string true "附件ID"
+// @Param part path int true "分片序号，从 0 开始"
+// @Success 200 {object} utils.Response{data=dot.AttachmentUpload} "上传进度"
+// @Failure 400 {object} utils.Response "附件不存在、分片大小不符或内容与声明不符"
+// @Failure 403 {object} utils.Response "没有权限"
+// @Router /chat/attachments/{id}/parts/{part} [put]
+func (w *WebSockerRouter) UploadAttachmentPart(c *gin.Context) {
+	attachment, ok := w.ownAttachment(c)
+	if !ok {
+		return
+	}
+	part, err := strconv.Atoi(c.Param("part"))
+	if err != nil || part < 0 {
+		utils.Error(c, "参数错误")
+		return
+	}
+	if uploadPendingCompletion(attachment) && part == attachment.Parts-1 {
+		// 最后一片已记录，无需重新写入
+		if w.finishAttachment(c, &attachment) {
+			utils.SuccessWithDefault(c, toAttachmentUpload(attachment))
+		}
+		return
+	}
+	if attachment.CompletedAt != nil || part != attachment.Parts {
+		utils.Fail(c, toAttachmentUpload(attachment), "分片序号不符")
+		return
+	}
+
+	expected := min(attachment.ChunkSize, attachment.Size-attachment.Received)
+	if c.Request.ContentLength >= 0 && c.Request.ContentLength != expected {
+		utils.Error(c, "分片大小不符")
+		return
+	}
+	// 多读一个字节以便识别超长的请求体
+	n, err := w.storage.PutPart(c.Request.Context(), attachment.AttachmentID, part, io.LimitReader(c.Request.Body, expected+1))
+	if err != nil {
+		global.Logger.Warn("写入附件分片失败: ", zap.Error(err))
+		utils.ErrorWithDefault(c)
+		return
+	}
+	if n != expected {
+		utils.Error(c, "分片大小不符")
+		return
+	}
+
+	updated, err := w.chatUpdate.AttachmentPart(attachment.AttachmentID, part, n)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 同一分片已被并发的请求记录
+			if current, err := w.chatFind.Attachment(attachment.AttachmentID); err == nil {
+				utils.Fail(c, toAttachmentUpload(current), "分片序号不符")
+				return
+			}
+		}
+		utils.ErrorWithDefault(c)
+		return
+	}
+
+	if uploadPendingCompletion(updated) && !w.finishAttachment(c, &updated) {
+		return
+	}
+	utils.SuccessWithDefault(c, toAttachmentUpload(updated))
+}
+
+// completeAttachment 合并附件的所有分片并标记完成。
+// 明文附件在合并后嗅探内容：与声明不符时删除附件及其缩略图，能解析出尺寸时以实际尺寸为准。
+func (w *WebSockerRouter) completeAttachment(ctx context.Context, attachment *entity.Attachment) error {
+	if err := w.storage.Complete(ctx, attachment.AttachmentID, attachment.Parts); err != nil {
+		global.Logger.Warn("合并附件分片失败: ", zap.Error(err))
+		return err
+	}
+
+	if attachment.Plaintext {
+		meta, err := w.probeAttachment(ctx, attachment.AttachmentID)
+		if err == nil {
+			err = meta.Verify(attachment.MimeType, attachment.Width, attachment.Height)
+		}
+		if errors.Is(err, media.ErrTypeMismatch) || errors.Is(err, media.ErrDimensionMismatch) {
+			w.discardAttachment(ctx, *attachment)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if meta.Width > 0 {
+			attachment.Width, attachment.Height = meta.Width, meta.Height
+		}
+	}
+
+	if err := w.chatUpdate.AttachmentCompleted(attachment.AttachmentID, attachment.Width, attachment.Height); err != nil {
+		return err
+	}
+	now := time.Now()
+	attachment.CompletedAt = &now
+	return nil
+}
+
+// probeAttachment 读取已合并的附件并嗅探其媒体信息
+func (w *WebSockerRouter) probeAttachment(ctx context.Context, attachmentID string) (media.Metadata, error) {
+	reader, _, err := w.storage.Open(ctx, attachmentID)
+	if err != nil {
+		global.Logger.Warn("读取附件失败: ", zap.Error(err))
+		return media.Metadata{}, err
+	}
+	defer reader.Close()
+	return media.Probe(reader)
+}
+
+// discardAttachment 删除附件及其缩略图的内容与记录
+func (w *WebSockerRouter) discardAttachment(ctx context.Context, attachment entity.Attachment) {
+	ids := []string{attachment.AttachmentID}
+	if attachment.ThumbnailID != "" {
+		ids = append(ids, attachment.ThumbnailID)
+	}
+	for _, id := range ids {
+		if err := w.storage.Delete(ctx, id); err != nil {
+			global.Logger.Warn("删除附件内容失败: ", zap.Error(err))
+		}
+	}
+	_ = w.chatDelete.Attachment(ids...)
+}
+
+// GetAttachmentURL 获取附件的限时签名下载链接。
+// @Summary 获取附件下载链接
+// @Description 为已上传完成的附件生成限时签名下载链接，缩略图上传完成时同时返回缩略图的下载链接。
+// @Description 只有附件所属房间的成员可以获取，下载链接无需携带访问令牌。
+// @Tags Chat
+// @Produce json
+// @Param id path string true "附件ID"
+// @Success 200 {object} utils.Response{data=dot.AttachmentURL} "下载链接"
+// @Failure 400 {object} utils.Response "附件不存在或尚未上传完成"
+// @Failure 403 {object} utils.Response "不在房间内"
+// @Router /chat/attachments/{id}/url [get]
+func (w *WebSockerRouter) GetAttachmentURL(c *gin.Context) {
+	attachment, err := w.chatFind.Attachment(c.Param("id"))
+	if err != nil || attachment.CompletedAt == nil {
+		if err == nil || errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.Error(c, "附件不存在")
+		} else {
+			utils.ErrorWithDefault(c)
+		}
+		return
+	}
+	if w.chatFind.IsTheUserIsInTheRoom(middleware.CurrentUser(c).UUID, attachment.RoomUUID) == chat.NotInRoom {
+		utils.Forbidden(c, "不在房间内")
+		return
+	}
+
+	expiresAt := time.Now().Add(config.GetConfig().Storage.DownloadURLTTL)
+	// 由当前请求路径推出附件集合的路径前缀，避免在此处重复路由分组
+	prefix := strings.TrimSuffix(c.Request.URL.Path, attachment.AttachmentID+"/url")
+	result := dot.AttachmentURL{
+		URL:       signedDownloadURL(prefix, attachment.AttachmentID, expiresAt),
+		ExpiresAt: expiresAt,
+	}
+	if attachment.ThumbnailID != "" {
+		if thumbnail, err := w.chatFind.Attachment(attachment.ThumbnailID); err == nil && thumbnail.CompletedAt != nil {
+			result.ThumbnailURL = signedDownloadURL(prefix, thumbnail.AttachmentID, expiresAt)
+		}
+	}
+	utils.SuccessWithDefault(c, result)
+}
+
+// signedDownloadURL 生成附件在 expiresAt 前有效的签名下载链接
+func signedDownloadURL(prefix, attachmentID string, expiresAt time.Time) string {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", encryption.SignResource(attachmentResource(attachmentID), expiresAt, []byte(config.GetConfig().Auth.Secret)))
+	return prefix + attachmentID + "/download?" + query.Encode()
+}
+
+// DownloadAttachment 通过签名链接下载附件密文。
+// @Summary 下载附件
+// @Description 校验链接签名与有效期后返回附件的密文字节，不需要访问令牌。
+// @Tags Chat
+// @Produce octet-stream
+// @Param id path string true "附件ID"
+// @Param expires query int true "链接过期时间（Unix 秒）"
+// @Param signature query string true "链接签名"
+// @Success 200 {file} binary "附件密文"
+// @Failure 400 {object} utils.Response "附件不存在"
+// @Failure 403 {object} utils.Response "签名无效或链接已过期"
+// @Router /chat/attachments/{id}/download [get]
+func (w *WebSockerRouter) DownloadAttachment(c *gin.Context) {
+	var params dot.DownloadParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	attachmentID := c.Param("id")
+	err := encryption.VerifyResource(attachmentResource(attachmentID), params.Expires, params.Signature, []byte(config.GetConfig().Auth.Secret))
+	if errors.Is(err, encryption.ErrTokenExpired) {
+		utils.Forbidden(c, "链接已过期")
+		return
+	}
+	if err != nil {
+		utils.Forbidden(c, "签名无效")
+		return
+	}
+
+	attachment, err := w.chatFind.Attachment(attachmentID)
+	if err != nil || attachment.CompletedAt == nil {
+		utils.Error(c, "附件不存在")
+		return
+	}
+	reader, size, err := w.storage.Open(c.Request.Context(), attachment.AttachmentID)
+	if err != nil {
+		global.Logger.Warn("读取附件失败: ", zap.Error(err))
+		utils.Error(c, "附件不存在")
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, size, "application/octet-stream", reader, map[string]string{
+		"Cache-Control": "private, max-age=" + strconv.Itoa(int(time.Until(time.Unix(params.Expires, 0)).Seconds())),
+	})
+}
@@ -1,32 +1,50 @@
 package chat
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"qianmianyao/MistChat-Server/pkg/global"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"qianmianyao/MistChat-Server/internal/middleware"
 	"qianmianyao/MistChat-Server/internal/models/dot"
 	"qianmianyao/MistChat-Server/internal/models/entity"
 	"qianmianyao/MistChat-Server/internal/services/chat"
 	"qianmianyao/MistChat-Server/internal/websocket"
+	"qianmianyao/MistChat-Server/pkg/config"
 	"qianmianyao/MistChat-Server/pkg/encryption"
+	"qianmianyao/MistChat-Server/pkg/ratelimit"
+	"qianmianyao/MistChat-Server/pkg/storage"
 	"qianmianyao/MistChat-Server/pkg/utils"
 )
 
 // WebSockerRouter 定义了处理聊天相关 WebSocket 请求的路由结构。
 type WebSockerRouter struct {
+	hub        *websocket.Hub
 	chatCreate *chat.Create
 	chatFind   *chat.Find
 	chatUpdate *chat.Update
+	chatDelete *chat.Delete
+	storage    storage.Storage // 附件存储后端
+
+	joinFailures *ratelimit.FailureLimiter
 }
 
-// NewWebSockerRouter 创建并返回一个新的 WebSockerRouter 实例。
-func NewWebSockerRouter() *WebSockerRouter {
+// NewWebSockerRouter 创建并返回一个新的 WebSockerRouter 实例，hub 用于向在线客户端推送消息，attachmentStorage 为附件存储后端。
+func NewWebSockerRouter(hub *websocket.Hub, attachmentStorage storage.Storage) *WebSockerRouter {
 	return &WebSockerRouter{
+		hub:        hub,
 		chatCreate: chat.NewCreate(),
 		chatFind:   chat.NewFind(),
 		chatUpdate: chat.NewUpdate(),
+		chatDelete: chat.NewDelete(),
+		storage:    attachmentStorage,
+
+		joinFailures: ratelimit.NewFailureLimiter(config.GetConfig().Room.JoinFailureWindow),
 	}
 }
 
@@ -36,16 +54,79 @@ func NewWebSockerRouter() *WebSockerRouter {
 // @Tags Chat
 // @Accept json
 // @Produce json
-// @Param username query string false "用户名 (可选)"
+// @Param token query string true "访问令牌"
+// @Param device_id query int false "已登记的设备号，缺省为主设备"
 // @Success 101 {string} string "Switching Protocols" "成功切换协议到WebSocket"
+// @Failure 401 {object} utils.Response "令牌缺失或无效"
 // @Router /chat/connect [get]
-func (w *WebSockerRouter) WsHandler(hub *websocket.Hub) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		websocket.ServeWs(hub, c.Writer, c.Request)
+func (w *WebSockerRouter) WsHandler(c *gin.Context) {
+	var params dot.DeviceParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	user := middleware.CurrentUser(c)
+	deviceId := resolveDeviceId(params.DeviceId)
+	if !w.chatFind.IsDeviceExist(user.UUID, deviceId) {
+		utils.Error(c, "设备未登记")
+		return
 	}
+	websocket.ServeWs(w.hub, c.Writer, c.Request, user, deviceId)
+}
+
+// resolveDeviceId 未指定设备号时使用主设备
+func resolveDeviceId(deviceId int) int {
+	if deviceId <= 0 {
+		return dot.DefaultDeviceId
+	}
+	return deviceId
+}
+
+// errRefreshTokenReused 刷新令牌已被轮换或吊销
+var errRefreshTokenReused = errors.New("refresh token has been rotated")
+
+// issueTokens 为用户签发一对新的访问令牌与刷新令牌，并使标识为 previousID 的旧刷新令牌失效。
+// 新注册用户的 previousID 为空。
+func (w *WebSockerRouter) issueTokens(uuid, previousID string) (dot.TokenResponse, error) {
+	authConfig := config.GetConfig().Auth
+	secret := []byte(authConfig.Secret)
+
+	refreshID, err := encryption.GenerateUID("r_")
+	if err != nil {
+		return dot.TokenResponse{}, err
+	}
+	accessToken, expiresAt, err := encryption.GenerateToken(uuid, encryption.AccessToken, "", authConfig.AccessTokenTTL, secret)
+	if err != nil {
+		return dot.TokenResponse{}, err
+	}
+	refreshToken, _, err := encryption.GenerateToken(uuid, encryption.RefreshToken, refreshID, authConfig.RefreshTokenTTL, secret)
+	if err != nil {
+		return dot.TokenResponse{}, err
+	}
+	rotated, err := w.chatUpdate.RotateRefreshToken(uuid, previousID, refreshID)
+	if err != nil {
+		return dot.TokenResponse{}, err
+	}
+	if !rotated {
+		return dot.TokenResponse{}, errRefreshTokenReused
+	}
+	return dot.TokenResponse{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: expiresAt,
+		RefreshToken:         refreshToken,
+	}, nil
 }
 
 // Register 处理用户注册请求。
+// @Summary 用户注册
+// @Description 创建新用户并签发访问令牌与刷新令牌。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param user body dot.RegisterData true "用户名"
+// @Success 200 {object} utils.Response{data=dot.RegisterResponse} "注册成功"
+// @Failure 400 {object} utils.Response "请求参数错误"
+// @Router /chat/register [post]
 func (w *WebSockerRouter) Register(c *gin.Context) {
 	var data dot.RegisterData
 	if err := c.ShouldBindJSON(&data); err != nil {
@@ -70,7 +151,114 @@ func (w *WebSockerRouter) Register(c *gin.Context) {
 		utils.ErrorWithDefault(c)
 		return
 	}
-	utils.Success(c, dot.RegisterResponse{Username: data.Username, UUID: uuid}, "注册成功")
+	// 登记主设备
+	device, err := w.chatCreate.Device(uuid, "")
+	if err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	tokens, err := w.issueTokens(uuid, "")
+	if err != nil {
+		global.Logger.Error(fmt.Sprintf("Failed to issue tokens for %s: %v", uuid, err))
+		utils.ErrorWithDefault(c)
+		return
+	}
+	utils.Success(c, dot.RegisterResponse{
+		Username:      data.Username,
+		UUID:          uuid,
+		DeviceId:      device.DeviceID,
+		TokenResponse: tokens,
+	}, "注册成功")
+}
+
+// RegisterDevice 为当前用户登记一台新设备。
+// @Summary 登记设备
+// @Description 为当前用户登记一台新设备并返回分配的设备号，新设备需要上传自己的 Signal 密钥束。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param device body dot.RegisterDeviceData true "设备名称"
+// @Success 200 {object} utils.Response{data=dot.DeviceInfo} "登记成功"
+// @Failure 500 {object} utils.Response "服务器内部错误"
+// @Router /chat/register_device [post]
+func (w *WebSockerRouter) RegisterDevice(c *gin.Context) {
+	var data dot.RegisterDeviceData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	device, err := w.chatCreate.Device(middleware.CurrentUser(c).UUID, data.Name)
+	if err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	utils.SuccessWithDefault(c, dot.DeviceInfo{DeviceId: device.DeviceID, Name: device.Name})
+}
+
+// GetUserDevices 获取指定用户已登记的所有设备。
+// @Summary 获取用户设备
+// @Description 根据用户的聊天ID (cuid) 返回其所有设备，发送方需要为每台设备分别建立会话。
+// @Tags Chat
+// @Produce json
+// @Param cuid path uint true "用户的聊天ID"
+// @Success 200 {object} utils.Response{data=[]dot.DeviceInfo} "设备列表"
+// @Failure 400 {object} utils.Response "无效的用户ID格式"
+// @Router /chat/get_user_devices/{cuid} [get]
+func (w *WebSockerRouter) GetUserDevices(c *gin.Context) {
+	num, err := strconv.ParseUint(c.Param("cuid"), 10, 0)
+	if err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	devices, err := w.chatFind.Devices(w.chatFind.ChatUserUUIDByID(uint(num)))
+	if err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	infos := make([]dot.DeviceInfo, 0, len(devices))
+	for _, device := range devices {
+		infos = append(infos, dot.DeviceInfo{DeviceId: device.DeviceID, Name: device.Name, LastSeenAt: device.LastSeenAt})
+	}
+	utils.SuccessWithDefault(c, infos)
+}
+
+// RefreshToken 使用刷新令牌换取新的令牌对。
+// @Summary 刷新令牌
+// @Description 校验刷新令牌并签发新的访问令牌与刷新令牌。刷新令牌只能使用一次，刷新后旧的刷新令牌立即失效。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param token body dot.RefreshTokenData true "刷新令牌"
+// @Success 200 {object} utils.Response{data=dot.TokenResponse} "刷新成功"
+// @Failure 401 {object} utils.Response "刷新令牌无效或已过期"
+// @Router /chat/refresh_token [post]
+func (w *WebSockerRouter) RefreshToken(c *gin.Context) {
+	var data dot.RefreshTokenData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	claims, err := encryption.ParseToken(data.RefreshToken, encryption.RefreshToken, []byte(config.GetConfig().Auth.Secret))
+	if err != nil {
+		utils.Unauthorized(c, "刷新令牌无效或已过期")
+		return
+	}
+	if w.chatFind.IsUserExist(claims.UUID) == chat.UserNotExist {
+		utils.Unauthorized(c, "用户不存在")
+		return
+	}
+
+	tokens, err := w.issueTokens(claims.UUID, claims.ID)
+	if errors.Is(err, errRefreshTokenReused) {
+		utils.Unauthorized(c, "刷新令牌无效或已过期")
+		return
+	}
+	if err != nil {
+		global.Logger.Error(fmt.Sprintf("Failed to issue tokens for %s: %v", claims.UUID, err))
+		utils.ErrorWithDefault(c)
+		return
+	}
+	utils.SuccessWithDefault(c, tokens)
 }
 
 // CheckRoomPasswordRequired 检查加入房间是否需要密码。
@@ -106,11 +294,11 @@ func (w *WebSockerRouter) CheckRoomPasswordRequired(c *gin.Context) {
 
 // CreateRoom 处理创建新聊天房间的请求。
 // @Summary 创建聊天房间
-// @Description 创建一个新的聊天房间，可以设置房间名和可选的密码。
+// @Description 创建一个新的聊天房间，可以设置房间名和可选的密码，创建者成为房主。
 // @Tags Chat
 // @Accept json
 // @Produce json
-// @Param room body dot.CreateRoomData true "创建房间所需的数据 (房间名, 用户UUID, 可选密码)"
+// @Param room body dot.CreateRoomData true "创建房间所需的数据 (房间名, 可选密码)"
 // @Success 200 {object} utils.Response{data=map[string]string} "成功创建房间，返回房间UUID"
 // @Failure 400 {object} utils.Response "请求参数错误"
 // @Failure 500 {object} utils.Response "服务器内部错误 (创建房间或添加成员失败)"
@@ -132,7 +320,7 @@ func (w *WebSockerRouter) CreateRoom(c *gin.Context) {
 		utils.ErrorWithDefault(c)
 		return
 	}
-	if err := w.chatCreate.RoomMembers(data.UserUUID, roomId); err != nil {
+	if err := w.chatCreate.RoomMembers(middleware.CurrentUser(c).UUID, roomId, entity.RoomRoleOwner); err != nil {
 		utils.ErrorWithDefault(c)
 		return
 	}
@@ -142,13 +330,16 @@ func (w *WebSockerRouter) CreateRoom(c *gin.Context) {
 // JoinRoom 处理用户加入现有聊天房间的请求。
 // @Summary 加入聊天房间
 // @Description 用户根据房间UUID和可选的密码加入一个已存在的聊天房间。
+// @Description 同一用户对同一房间或同一 IP 在时间窗口内密码错误次数过多时返回 TooManyRequestsCode。
 // @Tags Chat
 // @Accept json
 // @Produce json
-// @Param join body dot.JoinRoomData true "加入房间所需的数据 (房间UUID, 用户UUID, 可选密码)"
+// @Param join body dot.JoinRoomData true "加入房间所需的数据 (房间UUID, 可选密码)"
 // @Success 200 {object} utils.Response "成功加入房间"
-// @Failure 400 {object} utils.Response "请求参数错误"
+// @Failure 400 {object} utils.Response "请求参数错误或已在房间内"
 // @Failure 401 {object} utils.Response "密码错误"
+// @Failure 403 {object} utils.Response "已被该房间封禁"
+// @Failure 429 {object} utils.Response "密码错误次数过多"
 // @Failure 500 {object} utils.Response "服务器内部错误 (添加成员失败)"
 // @Router /chat/join-room [post]
 func (w *WebSockerRouter) JoinRoom(c *gin.Context) {
@@ -157,22 +348,117 @@ func (w *WebSockerRouter) JoinRoom(c *gin.Context) {
 		utils.ErrorWithDefault(c)
 		return
 	}
-	verificationResults := w.chatFind.VerifyPassword(data.RoomUUID, data.Password)
+	if w.chatFind.IsBanned(middleware.CurrentUser(c).UUID, data.RoomUUID) {
+		utils.Forbidden(c, "已被该房间封禁")
+		return
+	}
+	if w.chatFind.IsRoomArchived(data.RoomUUID) {
+		utils.Error(c, "房间已归档")
+		return
+	}
+	// 已在房间内时不再添加成员记录，避免覆盖原有角色或重复通知
+	if w.chatFind.IsTheUserIsInTheRoom(middleware.CurrentUser(c).UUID, data.RoomUUID) == chat.InRoom {
+		utils.Error(c, "已在房间内")
+		return
+	}
+
+	// 失败计数只针对发起请求的用户与 IP，避免他人猜密码导致整个房间无法加入
+	roomConfig := config.GetConfig().Room
+	userKey := "room:" + data.RoomUUID + ":user:" + middleware.CurrentUser(c).UUID
+	ipKey := "ip:" + c.ClientIP()
+	if w.joinFailures.Blocked(userKey, roomConfig.JoinMaxFailuresPerUser) ||
+		w.joinFailures.Blocked(ipKey, roomConfig.JoinMaxFailuresPerIP) {
+		utils.TooManyRequests(c, "密码错误次数过多，请稍后再试")
+		return
+	}
+
+	verificationResults, needsRehash := w.chatFind.VerifyPassword(data.RoomUUID, data.Password)
 	if verificationResults == chat.PasswordIncorrect {
+		w.joinFailures.Fail(userKey)
+		w.joinFailures.Fail(ipKey)
 		utils.FailWithDefault(c, "密码错误")
 		return
 	}
+	// IP 计数只随时间窗口过期，成功加入（包括无密码房间）不清零，避免穿插成功请求绕过限制
+	w.joinFailures.Reset(userKey)
 
-	if err := w.chatCreate.RoomMembers(data.UserUUID, data.RoomUUID); err != nil {
+	if err := w.chatCreate.RoomMembers(middleware.CurrentUser(c).UUID, data.RoomUUID, entity.RoomRoleMember); err != nil {
 		utils.ErrorWithDefault(c)
 		return
 	}
+	// 历史明文密码在首次成功加入后迁移为哈希
+	if needsRehash {
+		if hash, err := encryption.HashPassword(data.Password); err == nil {
+			_ = w.chatUpdate.RoomPassword(data.RoomUUID, hash)
+		}
+	}
+	w.hub.NotifyRoom(data.RoomUUID, dot.RoomMemberNotice{
+		Event:    dot.MemberJoinedEvent,
+		RoomUUID: data.RoomUUID,
+		UUID:     middleware.CurrentUser(c).UUID,
+	})
+	go w.hub.ResetSenderKeys(data.RoomUUID)
 	utils.SuccessWithDefault(c, nil)
 }
 
+// GetSenderKeyStatus 查询房间内尚未收到当前用户指定 Sender Key 的成员。
+// @Summary 查询 Sender Key 分发状态
+// @Description 返回房间内尚未收到当前用户指定分发 ID 与代数的 Sender Key 的成员及其设备，客户端据此按设备补发。
+// @Tags Signal
+// @Produce json
+// @Param room_uuid query string true "房间UUID"
+// @Param distribution_id query string true "Sender Key 分发 ID"
+// @Param generation query int false "Sender Key 代数"
+// @Success 200 {object} utils.Response{data=dot.SenderKeyStatusResponse} "未收到的成员列表"
+// @Failure 400 {object} utils.Response "请求参数错误或不在房间内"
+// @Router /chat/sender_key_status [get]
+func (w *WebSockerRouter) GetSenderKeyStatus(c *gin.Context) {
+	var params dot.SenderKeyStatusParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	uuid := middleware.CurrentUser(c).UUID
+	if w.chatFind.IsTheUserIsInTheRoom(uuid, params.RoomUUID) == chat.NotInRoom {
+		utils.Error(c, "不在房间内")
+		return
+	}
+
+	holders, err := w.chatFind.SenderKeyHolders(params.RoomUUID, uuid, params.DistributionId, params.Generation)
+	if err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	var members []string
+	for _, member := range w.chatFind.AllUsersInTheRoom(params.RoomUUID) {
+		if member != uuid {
+			members = append(members, member)
+		}
+	}
+	deviceIDs, err := w.chatFind.DeviceIDsOfUsers(members)
+	if err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+
+	result := dot.SenderKeyStatusResponse{Missing: []string{}, MissingDevices: map[string][]int{}}
+	for _, member := range members {
+		for _, deviceId := range deviceIDs[member] {
+			if !holders[member][deviceId] {
+				result.MissingDevices[member] = append(result.MissingDevices[member], deviceId)
+			}
+		}
+		if len(result.MissingDevices[member]) > 0 {
+			result.Missing = append(result.Missing, member)
+		}
+	}
+	utils.SuccessWithDefault(c, result)
+}
+
 // SaveSignalKey 处理上传用户 Signal 协议密钥束的请求。
 // @Summary 保存Signal密钥
-// @Description接收并存储用户的 Signal 协议密钥，包括身份密钥、预签名密钥和一次性密钥。
+// @Description 接收并存储用户的 Signal 协议密钥，包括身份密钥、预签名密钥和一次性密钥。
+// @Description 预签名密钥的 XEdDSA 签名会先用身份密钥校验，校验失败时返回 InvalidSignatureCode 且不保存任何密钥。
 // @Tags Signal
 // @Accept json
 // @Produce json
@@ -188,53 +474,219 @@ func (w *WebSockerRouter) SaveSignalKey(c *gin.Context) {
 		return
 	}
 
-	var signalIdentityKey = entity.SignalIdentityKey{
-		ChatUserUUID:   data.Address.UUID,
-		RegistrationID: uint32(data.RegistrationId),
-		IdentityKey:    data.IdentityKey,
+	uuid := middleware.CurrentUser(c).UUID
+	deviceId := dot.DefaultDeviceId
+	if data.Address != nil {
+		deviceId = resolveDeviceId(data.Address.DeviceId)
 	}
-	// 创建身份密钥
-	if err := w.chatCreate.SignalIdentityKey(signalIdentityKey); err != nil {
-		utils.ErrorWithDefault(c)
+	if !w.chatFind.IsDeviceExist(uuid, deviceId) {
+		utils.Error(c, "设备未登记")
+		return
+	}
+	// 持久化任何密钥之前先校验签名预密钥的签名
+	if !verifySignedPreKey(data.IdentityKey, data.SignedPreKey) {
+		utils.ErrorWithCode(c, utils.InvalidSignatureCode, "签名预密钥签名无效")
 		return
 	}
 
-	var signalSignedPreKey = entity.SignalSignedPreKey{
-		ChatUserUUID:        data.Address.UUID,
-		PreKeyID:            uint32(data.PreKey.Id),
-		PreKeyPublic:        data.PreKey.PublicKey,
-		PreKeySignature:     data.SignedPreKey.Signature,
-		ValidUntilTimestamp: 0,
-		IsActive:            true,
+	// 重复上传相同的身份密钥视为幂等操作；身份密钥不同时必须走替换流程，以便通知相关用户
+	existing := w.chatFind.SignalIdentityKey(uuid, deviceId)
+	switch existing.IdentityKey {
+	case "":
+		var signalIdentityKey = entity.SignalIdentityKey{
+			ChatUserUUID:   uuid,
+			DeviceID:       deviceId,
+			RegistrationID: uint32(data.RegistrationId),
+			IdentityKey:    data.IdentityKey,
+		}
+		// 创建身份密钥
+		if err := w.chatCreate.SignalIdentityKey(signalIdentityKey); err != nil {
+			utils.ErrorWithDefault(c)
+			return
+		}
+	case data.IdentityKey:
+	default:
+		utils.ErrorWithCode(c, utils.IdentityKeyExistsCode, "身份密钥已存在，请使用替换接口")
+		return
 	}
+
 	// 创建预签名密钥
-	if err := w.chatCreate.SignalSignedPreKey(signalSignedPreKey); err != nil {
+	if err := w.saveSignedPreKey(uuid, deviceId, data.SignedPreKey); err != nil {
 		utils.ErrorWithDefault(c)
 		return
 	}
 
-	var signalPreKey = entity.SignalPreKey{
-		ChatUserUUID: data.Address.UUID,
-		PreKeyID:     uint32(data.PreKey.Id),
-		PreKeyPublic: data.PreKey.PublicKey,
-		IsUsed:       false,
+	if data.PreKey != nil {
+		var signalPreKey = entity.SignalPreKey{
+			ChatUserUUID: uuid,
+			DeviceID:     deviceId,
+			PreKeyID:     uint32(data.PreKey.Id),
+			PreKeyPublic: data.PreKey.PublicKey,
+		}
+		// 创建一次性密钥
+		if err := w.chatCreate.SignalPreKey(signalPreKey); err != nil {
+			utils.ErrorWithDefault(c)
+			return
+		}
 	}
-	// 创建一次性密钥
-	if err := w.chatCreate.SignalPreKey(signalPreKey); err != nil {
+
+	utils.SuccessWithDefault(c, nil)
+}
+
+// ReplaceIdentityKey 替换设备的身份密钥，用于客户端重装等场景。
+// @Summary 替换身份密钥
+// @Description 替换当前用户指定设备的身份密钥，旧密钥写入历史记录，旧的签名预密钥与一次性密钥全部作废。
+// @Description 替换成功后会向所有与该用户共享房间的用户推送 identity_key_changed 系统通知。
+// @Tags Signal
+// @Accept json
+// @Produce json
+// @Param keys body dot.ReplaceIdentityKeyData true "新的身份密钥、签名预密钥与可选的一次性预密钥"
+// @Success 200 {object} utils.Response "替换成功"
+// @Failure 400 {object} utils.Response "请求参数错误、设备未登记或签名无效"
+// @Failure 500 {object} utils.Response "服务器内部错误"
+// @Router /chat/replace_identity_key [post]
+func (w *WebSockerRouter) ReplaceIdentityKey(c *gin.Context) {
+	var data dot.ReplaceIdentityKeyData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	uuid := middleware.CurrentUser(c).UUID
+	deviceId := resolveDeviceId(data.DeviceId)
+	if !w.chatFind.IsDeviceExist(uuid, deviceId) {
+		utils.Error(c, "设备未登记")
+		return
+	}
+	if w.chatFind.SignalIdentityKey(uuid, deviceId).IdentityKey == "" {
+		utils.Error(c, "设备尚未上传身份密钥")
+		return
+	}
+	if !verifySignedPreKey(data.IdentityKey, data.SignedPreKey) {
+		utils.ErrorWithCode(c, utils.InvalidSignatureCode, "签名预密钥签名无效")
+		return
+	}
+
+	signalPreKeys := make([]entity.SignalPreKey, 0, len(data.PreKeys))
+	for _, preKey := range data.PreKeys {
+		signalPreKeys = append(signalPreKeys, entity.SignalPreKey{
+			ChatUserUUID: uuid,
+			DeviceID:     deviceId,
+			PreKeyID:     uint32(preKey.Id),
+			PreKeyPublic: preKey.PublicKey,
+		})
+	}
+
+	signalConfig := config.GetConfig().Signal
+	changed, err := w.chatUpdate.ReplaceSignalIdentityKey(entity.SignalIdentityKey{
+		ChatUserUUID:   uuid,
+		DeviceID:       deviceId,
+		RegistrationID: uint32(data.RegistrationId),
+		IdentityKey:    data.IdentityKey,
+	}, entity.SignalSignedPreKey{
+		ChatUserUUID:        uuid,
+		DeviceID:            deviceId,
+		PreKeyID:            uint32(data.SignedPreKey.Id),
+		PreKeyPublic:        data.SignedPreKey.PublicKey,
+		PreKeySignature:     data.SignedPreKey.Signature,
+		ValidUntilTimestamp: time.Now().Add(signalConfig.SignedPreKeyValidity).Unix(),
+		IsActive:            true,
+	}, signalPreKeys)
+	if err != nil {
 		utils.ErrorWithDefault(c)
 		return
 	}
+	// 事务提交后才通知，且身份密钥未变化时不通知，避免对端误报安全码变化
+	if changed {
+		go w.hub.NotifyIdentityKeyChanged(uuid, deviceId)
+	}
 
 	utils.SuccessWithDefault(c, nil)
 }
 
+// verifySignedPreKey 使用 Base64 编码的身份公钥校验签名预密钥的 XEdDSA 签名，缺少公钥或签名时校验失败
+func verifySignedPreKey(identityKey string, signedPreKey dot.SignedPreKey) bool {
+	if signedPreKey.PublicKey == "" || signedPreKey.Signature == "" {
+		return false
+	}
+	publicKey, err := encryption.DecodeSignalPublicKey(identityKey)
+	if err != nil {
+		return false
+	}
+	message, err := base64.StdEncoding.DecodeString(signedPreKey.PublicKey)
+	if err != nil {
+		return false
+	}
+	signature, err := base64.StdEncoding.DecodeString(signedPreKey.Signature)
+	if err != nil {
+		return false
+	}
+	return encryption.VerifyXEdDSA(publicKey, message, signature)
+}
+
+// saveSignedPreKey 保存设备的新签名预密钥并为其设置有效期，旧密钥进入宽限期
+func (w *WebSockerRouter) saveSignedPreKey(uuid string, deviceId int, signedPreKey dot.SignedPreKey) error {
+	signalConfig := config.GetConfig().Signal
+	now := time.Now()
+	return w.chatCreate.SignalSignedPreKey(entity.SignalSignedPreKey{
+		ChatUserUUID:        uuid,
+		DeviceID:            deviceId,
+		PreKeyID:            uint32(signedPreKey.Id),
+		PreKeyPublic:        signedPreKey.PublicKey,
+		PreKeySignature:     signedPreKey.Signature,
+		ValidUntilTimestamp: now.Add(signalConfig.SignedPreKeyValidity).Unix(),
+		IsActive:            true,
+	}, now.Add(signalConfig.SignedPreKeyGracePeriod).Unix())
+}
+
+// UploadSignedPreKey 上传设备的新签名预密钥。
+// @Summary 轮换签名预密钥
+// @Description 为当前用户的指定设备上传新的签名预密钥，新密钥立即生效，旧密钥在宽限期结束后停用。
+// @Description 签名需能由设备当前的身份密钥校验通过，否则返回 InvalidSignatureCode。
+// @Tags Signal
+// @Accept json
+// @Produce json
+// @Param key body dot.UploadSignedPreKeyData true "设备号与签名预密钥"
+// @Success 200 {object} utils.Response "上传成功"
+// @Failure 400 {object} utils.Response "请求参数错误或设备未登记"
+// @Failure 500 {object} utils.Response "服务器内部错误"
+// @Router /chat/upload_signed_prekey [post]
+func (w *WebSockerRouter) UploadSignedPreKey(c *gin.Context) {
+	var data dot.UploadSignedPreKeyData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	uuid := middleware.CurrentUser(c).UUID
+	deviceId := resolveDeviceId(data.DeviceId)
+	if !w.chatFind.IsDeviceExist(uuid, deviceId) {
+		utils.Error(c, "设备未登记")
+		return
+	}
+	signalIdentityKey := w.chatFind.SignalIdentityKey(uuid, deviceId)
+	if signalIdentityKey.IdentityKey == "" {
+		utils.Error(c, "设备尚未上传身份密钥")
+		return
+	}
+	if !verifySignedPreKey(signalIdentityKey.IdentityKey, data.SignedPreKey) {
+		utils.ErrorWithCode(c, utils.InvalidSignatureCode, "签名预密钥签名无效")
+		return
+	}
+	if err := w.saveSignedPreKey(uuid, deviceId, data.SignedPreKey); err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	utils.SuccessWithDefault(c, nil)
+}
+
 // GetSignalKey 处理获取指定用户 Signal 协议密钥束的请求。
 // @Summary 获取Signal密钥
-// @Description 根据用户的聊天ID (cuid) 查询并返回其 Signal 协议密钥束，并将使用的一次性密钥标记为已用。
+// @Description 根据用户的聊天ID (cuid) 与设备号查询并返回该设备的 Signal 协议密钥束。
+// @Description 返回的一次性预密钥会被原子地取出并删除；池为空时返回兜底密钥，两者都没有时不返回 preKey。
 // @Tags Signal
 // @Accept json
 // @Produce json
 // @Param cuid path uint true "用户的聊天ID"
+// @Param device_id query int false "设备号，缺省为主设备"
 // @Success 200 {object} utils.Response{data=dot.SignalData} "成功获取密钥束"
 // @Failure 400 {object} utils.Response "无效的用户ID格式"
 // @Failure 500 {object} utils.Response "服务器内部错误 (查询或更新密钥失败)"
@@ -246,43 +698,144 @@ func (w *WebSockerRouter) GetSignalKey(c *gin.Context) {
 		utils.ErrorWithDefault(c)
 		return
 	}
+	var params dot.DeviceParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
 	uuid := w.chatFind.ChatUserUUIDByID(uint(num))
+	deviceId := resolveDeviceId(params.DeviceId)
 
-	signalIdentityKey := w.chatFind.SignalIdentityKey(uuid)
-	signalSignedPreKey := w.chatFind.SignalSignedPreKey(uuid)
-	signalPreKey, err := w.chatFind.SignalPreKey(uuid)
-	if err != nil {
+	signalIdentityKey := w.chatFind.SignalIdentityKey(uuid, deviceId)
+	signalSignedPreKey := w.chatFind.SignalSignedPreKey(uuid, deviceId)
+	signalPreKey, err := w.chatDelete.ClaimSignalPreKey(uuid, deviceId)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		utils.ErrorWithDefault(c)
 		return
 	}
 	var data = dot.SignalData{
-		Address:        nil,
+		Address:        &dot.Address{UUID: uuid, DeviceId: deviceId},
 		RegistrationId: int(signalIdentityKey.RegistrationID),
 		IdentityKey:    signalIdentityKey.IdentityKey,
 		SignedPreKey: dot.SignedPreKey{
-			Id:        int(signalSignedPreKey.PreKeyID),
-			PublicKey: signalSignedPreKey.PreKeyPublic,
-			Signature: signalSignedPreKey.PreKeySignature,
+			Id:         int(signalSignedPreKey.PreKeyID),
+			PublicKey:  signalSignedPreKey.PreKeyPublic,
+			Signature:  signalSignedPreKey.PreKeySignature,
+			ValidUntil: signalSignedPreKey.ValidUntilTimestamp,
 		},
-		PreKey: dot.PreKey{
+	}
+	if err == nil {
+		data.PreKey = &dot.PreKey{
 			Id:        int(signalPreKey.PreKeyID),
 			PublicKey: signalPreKey.PreKeyPublic,
-		},
+		}
+	}
+	go w.hub.CheckPreKeyPool(uuid, deviceId)
+	utils.SuccessWithDefault(c, &data)
+}
+
+// UploadPreKeys 批量上传设备的一次性预密钥。
+// @Summary 批量上传一次性预密钥
+// @Description 为当前用户的指定设备追加一批一次性预密钥，用于补充已被取用的密钥；可同时替换兜底密钥。
+// @Tags Signal
+// @Accept json
+// @Produce json
+// @Param keys body dot.UploadPreKeysData true "设备号与一次性预密钥列表"
+// @Success 200 {object} utils.Response{data=dot.PreKeyCountResponse} "上传成功，返回剩余数量"
+// @Failure 400 {object} utils.Response "请求参数错误或设备未登记"
+// @Failure 500 {object} utils.Response "服务器内部错误"
+// @Router /chat/upload_signal_prekeys [post]
+func (w *WebSockerRouter) UploadPreKeys(c *gin.Context) {
+	var data dot.UploadPreKeysData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	uuid := middleware.CurrentUser(c).UUID
+	deviceId := resolveDeviceId(data.DeviceId)
+	if !w.chatFind.IsDeviceExist(uuid, deviceId) {
+		utils.Error(c, "设备未登记")
+		return
+	}
+	if len(data.PreKeys) == 0 && data.LastResortPreKey == nil {
+		utils.Error(c, "参数错误")
+		return
 	}
-	if err := w.chatUpdate.MarkUsed(signalPreKey.PreKeyID); err != nil {
+
+	signalPreKeys := make([]entity.SignalPreKey, 0, len(data.PreKeys))
+	for _, preKey := range data.PreKeys {
+		signalPreKeys = append(signalPreKeys, entity.SignalPreKey{
+			ChatUserUUID: uuid,
+			DeviceID:     deviceId,
+			PreKeyID:     uint32(preKey.Id),
+			PreKeyPublic: preKey.PublicKey,
+		})
+	}
+	if len(signalPreKeys) > 0 {
+		if err := w.chatCreate.SignalPreKeys(signalPreKeys); err != nil {
+			utils.ErrorWithDefault(c)
+			return
+		}
+	}
+	if data.LastResortPreKey != nil {
+		if err := w.chatCreate.SignalLastResortPreKey(entity.SignalPreKey{
+			ChatUserUUID: uuid,
+			DeviceID:     deviceId,
+			PreKeyID:     uint32(data.LastResortPreKey.Id),
+			PreKeyPublic: data.LastResortPreKey.PublicKey,
+		}); err != nil {
+			utils.ErrorWithDefault(c)
+			return
+		}
+	}
+
+	remaining, err := w.chatFind.UnusedSignalPreKeyCount(uuid, deviceId)
+	if err != nil {
 		utils.ErrorWithDefault(c)
 		return
 	}
-	utils.SuccessWithDefault(c, &data)
+	utils.SuccessWithDefault(c, dot.PreKeyCountResponse{DeviceId: deviceId, Remaining: remaining})
 }
 
-func (w *WebSockerRouter) GetUsersRooms(c *gin.Context) {
-	var params dot.GetUsersRoomsParams
+// GetPreKeyCount 查询设备剩余未使用的一次性预密钥数量。
+// @Summary 查询一次性预密钥余量
+// @Description 返回当前用户指定设备剩余未使用的一次性预密钥数量。
+// @Tags Signal
+// @Produce json
+// @Param device_id query int false "设备号，缺省为主设备"
+// @Success 200 {object} utils.Response{data=dot.PreKeyCountResponse} "剩余数量"
+// @Failure 400 {object} utils.Response "请求参数错误或设备未登记"
+// @Router /chat/signal_prekey_count [get]
+func (w *WebSockerRouter) GetPreKeyCount(c *gin.Context) {
+	var params dot.DeviceParams
 	if err := c.ShouldBindQuery(&params); err != nil {
 		utils.Error(c, "参数错误")
 		return
 	}
-	rooms, err := w.chatFind.UsersRooms(params.UserUUID)
+	uuid := middleware.CurrentUser(c).UUID
+	deviceId := resolveDeviceId(params.DeviceId)
+	if !w.chatFind.IsDeviceExist(uuid, deviceId) {
+		utils.Error(c, "设备未登记")
+		return
+	}
+	remaining, err := w.chatFind.UnusedSignalPreKeyCount(uuid, deviceId)
+	if err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	utils.SuccessWithDefault(c, dot.PreKeyCountResponse{DeviceId: deviceId, Remaining: remaining})
+}
+
+// GetUsersRooms 获取当前用户加入的所有房间。
+// @Summary 获取用户房间
+// @Description 返回当前认证用户加入的所有房间，已离开或已删除的房间不会返回，已归档的房间带有 ArchivedAt。
+// @Tags Chat
+// @Produce json
+// @Success 200 {object} utils.Response{data=[]entity.Room} "房间列表"
+// @Failure 500 {object} utils.Response "服务器内部错误"
+// @Router /chat/get_users_rooms [get]
+func (w *WebSockerRouter) GetUsersRooms(c *gin.Context) {
+	rooms, err := w.chatFind.UsersRooms(middleware.CurrentUser(c).UUID)
 	if err != nil {
 		utils.ErrorWithDefault(c)
 		return
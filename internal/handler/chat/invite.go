@@ -0,0 +1,207 @@
+package chat
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"qianmianyao/MistChat-Server/internal/middleware"
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/models/entity"
+	"qianmianyao/MistChat-Server/internal/services/chat"
+	"qianmianyao/MistChat-Server/pkg/encryption"
+	"qianmianyao/MistChat-Server/pkg/utils"
+)
+
+const (
+	// inviteCodePrefix 邀请码前缀
+	inviteCodePrefix = "i_"
+	// inviteCodeSize 邀请码随机部分的字节数，128 位随机数足以防止猜测
+	inviteCodeSize = 16
+)
+
+// canManageRoom 判断当前用户是否为房间的管理员或房主
+func (w *WebSockerRouter) canManageRoom(uuid, roomUUID string) bool {
+	role, err := w.chatFind.MemberRole(uuid, roomUUID)
+	return err == nil && chat.CanManageRoom(role)
+}
+
+func toRoomInviteInfo(invite entity.RoomInvite) dot.RoomInviteInfo {
+	return dot.RoomInviteInfo{
+		Code:      invite.Code,
+		RoomUUID:  invite.RoomUUID,
+		CreatedBy: invite.CreatedBy,
+		MaxUses:   invite.MaxUses,
+		Uses:      invite.Uses,
+		ExpiresAt: invite.ExpiresAt,
+		CreatedAt: invite.CreatedAt,
+	}
+}
+
+// CreateInvite 为房间生成邀请码。
+// @Summary 创建房间邀请
+// @Description 房间管理员或房主生成邀请码，可设置最大使用次数与有效时长，持有邀请码的用户无需密码即可加入。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param data body dot.CreateInviteData true "房间UUID、最大使用次数与有效时长"
+// @Success 200 {object} utils.Response{data=dot.RoomInviteInfo} "邀请信息"
+// @Failure 400 {object} utils.Response "请求参数错误"
+// @Failure 403 {object} utils.Response "没有权限"
+// @Router /chat/create_invite [post]
+func (w *WebSockerRouter) CreateInvite(c *gin.Context) {
+	var data dot.CreateInviteData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	uuid := middleware.CurrentUser(c).UUID
+	if !w.canManageRoom(uuid, data.RoomUUID) {
+		utils.Forbidden(c, "没有执行该操作的权限")
+		return
+	}
+
+	code, err := encryption.GenerateRandomID(inviteCodePrefix, inviteCodeSize)
+	if err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	invite := entity.RoomInvite{
+		Code:      code,
+		RoomUUID:  data.RoomUUID,
+		CreatedBy: uuid,
+		MaxUses:   data.MaxUses,
+	}
+	if data.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(data.ExpiresIn) * time.Second)
+		invite.ExpiresAt = &expiresAt
+	}
+	if err := w.chatCreate.RoomInvite(&invite); err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	utils.SuccessWithDefault(c, toRoomInviteInfo(invite))
+}
+
+// JoinByInvite 使用邀请码加入房间。
+// @Summary 通过邀请加入房间
+// @Description 使用有效的邀请码加入房间，无需房间密码。邀请码已撤销、过期或用尽时加入失败，被房间封禁的用户无法加入。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param data body dot.JoinByInviteData true "邀请码"
+// @Success 200 {object} utils.Response{data=map[string]string} "成功加入，返回房间UUID"
+// @Failure 400 {object} utils.Response "邀请码无效"
+// @Failure 403 {object} utils.Response "已被该房间封禁"
+// @Router /chat/join_by_invite [post]
+func (w *WebSockerRouter) JoinByInvite(c *gin.Context) {
+	var data dot.JoinByInviteData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	invite, err := w.chatFind.RoomInvite(data.Code)
+	if err != nil {
+		utils.Error(c, "邀请码无效")
+		return
+	}
+
+	uuid := middleware.CurrentUser(c).UUID
+	if w.chatFind.IsBanned(uuid, invite.RoomUUID) {
+		utils.Forbidden(c, "已被该房间封禁")
+		return
+	}
+	if w.chatFind.IsRoomArchived(invite.RoomUUID) {
+		utils.Error(c, "房间已归档")
+		return
+	}
+	result := map[string]string{"roomUUID": invite.RoomUUID}
+	// 已在房间内时不消耗邀请次数
+	if w.chatFind.IsTheUserIsInTheRoom(uuid, invite.RoomUUID) == chat.InRoom {
+		utils.SuccessWithDefault(c, result)
+		return
+	}
+
+	if _, err := w.chatUpdate.ConsumeRoomInvite(data.Code, uuid); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.Error(c, "邀请码已失效")
+			return
+		}
+		utils.ErrorWithDefault(c)
+		return
+	}
+	w.hub.NotifyRoom(invite.RoomUUID, dot.RoomMemberNotice{
+		Event:    dot.MemberJoinedEvent,
+		RoomUUID: invite.RoomUUID,
+		UUID:     uuid,
+	})
+	go w.hub.ResetSenderKeys(invite.RoomUUID)
+	utils.SuccessWithDefault(c, result)
+}
+
+// ListInvites 列出房间仍然有效的邀请码。
+// @Summary 查询房间邀请
+// @Description 房间管理员或房主查询未撤销、未过期且未用尽的邀请码。
+// @Tags Chat
+// @Produce json
+// @Param room_uuid query string true "房间UUID"
+// @Success 200 {object} utils.Response{data=[]dot.RoomInviteInfo} "邀请列表"
+// @Failure 400 {object} utils.Response "请求参数错误"
+// @Failure 403 {object} utils.Response "没有权限"
+// @Router /chat/list_invites [get]
+func (w *WebSockerRouter) ListInvites(c *gin.Context) {
+	var params dot.ListInvitesParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	if !w.canManageRoom(middleware.CurrentUser(c).UUID, params.RoomUUID) {
+		utils.Forbidden(c, "没有执行该操作的权限")
+		return
+	}
+
+	invites, err := w.chatFind.RoomInvites(params.RoomUUID)
+	if err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	result := make([]dot.RoomInviteInfo, 0, len(invites))
+	for _, invite := range invites {
+		result = append(result, toRoomInviteInfo(invite))
+	}
+	utils.SuccessWithDefault(c, result)
+}
+
+// RevokeInvite 撤销邀请码。
+// @Summary 撤销房间邀请
+// @Description 房间管理员或房主撤销邀请码，撤销后邀请码立即失效。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param data body dot.RevokeInviteData true "房间UUID与邀请码"
+// @Success 200 {object} utils.Response "撤销成功"
+// @Failure 400 {object} utils.Response "请求参数错误或邀请不存在"
+// @Failure 403 {object} utils.Response "没有权限"
+// @Router /chat/revoke_invite [post]
+func (w *WebSockerRouter) RevokeInvite(c *gin.Context) {
+	var data dot.RevokeInviteData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	if !w.canManageRoom(middleware.CurrentUser(c).UUID, data.RoomUUID) {
+		utils.Forbidden(c, "没有执行该操作的权限")
+		return
+	}
+
+	if err := w.chatDelete.RoomInvite(data.RoomUUID, data.Code); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.Error(c, "邀请不存在")
+			return
+		}
+		utils.ErrorWithDefault(c)
+		return
+	}
+	utils.SuccessWithDefault(c, nil)
+}
@@ -0,0 +1,124 @@
+package chat
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"qianmianyao/MistChat-Server/internal/middleware"
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/services/chat"
+	"qianmianyao/MistChat-Server/pkg/utils"
+)
+
+// moderate 以当前用户的身份执行房间管理操作，并将服务层错误映射为响应
+func (w *WebSockerRouter) moderate(c *gin.Context, action chat.ModerationAction) {
+	var data dot.ModerationData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+
+	err := w.hub.Moderate(data.RoomUUID, middleware.CurrentUser(c).UUID, data.TargetUUID, action, data.Reason)
+	switch {
+	case err == nil:
+		utils.SuccessWithDefault(c, nil)
+	case errors.Is(err, chat.ErrPermissionDenied):
+		utils.Forbidden(c, "没有执行该操作的权限")
+	case errors.Is(err, chat.ErrTargetNotInRoom):
+		utils.Error(c, "目标用户不在房间内")
+	case errors.Is(err, chat.ErrInvalidModeration):
+		utils.Error(c, "目标用户的角色不适用该操作")
+	default:
+		utils.ErrorWithDefault(c)
+	}
+}
+
+// KickMember 将成员踢出房间。
+// @Summary 踢出房间成员
+// @Description 管理员或房主将角色低于自己的成员踢出房间，被踢出的成员可以再次加入。房间成员会收到通知并重新分发 Sender Key。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param data body dot.ModerationData true "房间UUID与目标用户UUID"
+// @Success 200 {object} utils.Response "操作成功"
+// @Failure 400 {object} utils.Response "请求参数错误或目标不在房间内"
+// @Failure 403 {object} utils.Response "没有权限"
+// @Router /chat/kick_member [post]
+func (w *WebSockerRouter) KickMember(c *gin.Context) {
+	w.moderate(c, chat.KickMember)
+}
+
+// BanMember 封禁用户。
+// @Summary 封禁房间成员
+// @Description 管理员或房主封禁用户，目标在房间内时同时将其踢出；被封禁的用户无法再加入房间或在房间内发言。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param data body dot.ModerationData true "房间UUID、目标用户UUID与可选的封禁原因"
+// @Success 200 {object} utils.Response "操作成功"
+// @Failure 400 {object} utils.Response "请求参数错误"
+// @Failure 403 {object} utils.Response "没有权限"
+// @Router /chat/ban_member [post]
+func (w *WebSockerRouter) BanMember(c *gin.Context) {
+	w.moderate(c, chat.BanMember)
+}
+
+// UnbanMember 解除封禁。
+// @Summary 解除封禁
+// @Description 管理员或房主解除用户在房间内的封禁。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param data body dot.ModerationData true "房间UUID与目标用户UUID"
+// @Success 200 {object} utils.Response "操作成功"
+// @Failure 400 {object} utils.Response "请求参数错误"
+// @Failure 403 {object} utils.Response "没有权限"
+// @Router /chat/unban_member [post]
+func (w *WebSockerRouter) UnbanMember(c *gin.Context) {
+	w.moderate(c, chat.UnbanMember)
+}
+
+// PromoteMember 将成员提升为管理员。
+// @Summary 提升为管理员
+// @Description 房主将普通成员提升为管理员。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param data body dot.ModerationData true "房间UUID与目标用户UUID"
+// @Success 200 {object} utils.Response "操作成功"
+// @Failure 400 {object} utils.Response "请求参数错误或目标不是普通成员"
+// @Failure 403 {object} utils.Response "不是房主"
+// @Router /chat/promote_member [post]
+func (w *WebSockerRouter) PromoteMember(c *gin.Context) {
+	w.moderate(c, chat.PromoteMember)
+}
+
+// DemoteMember 将管理员降为普通成员。
+// @Summary 撤销管理员
+// @Description 房主将管理员降为普通成员。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param data body dot.ModerationData true "房间UUID与目标用户UUID"
+// @Success 200 {object} utils.Response "操作成功"
+// @Failure 400 {object} utils.Response "请求参数错误或目标不是管理员"
+// @Failure 403 {object} utils.Response "不是房主"
+// @Router /chat/demote_member [post]
+func (w *WebSockerRouter) DemoteMember(c *gin.Context) {
+	w.moderate(c, chat.DemoteMember)
+}
+
+// TransferOwnership 转让房主。
+// @Summary 转让房主
+// @Description 房主将房间转让给另一名成员，原房主降为管理员。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param data body dot.ModerationData true "房间UUID与新房主UUID"
+// @Success 200 {object} utils.Response "操作成功"
+// @Failure 400 {object} utils.Response "请求参数错误或目标不在房间内"
+// @Failure 403 {object} utils.Response "不是房主"
+// @Router /chat/transfer_ownership [post]
+func (w *WebSockerRouter) TransferOwnership(c *gin.Context) {
+	w.moderate(c, chat.TransferOwnership)
+}
@@ -0,0 +1,38 @@
+package chat
+
+import (
+	"github.com/gin-gonic/gin"
+	"qianmianyao/MistChat-Server/internal/middleware"
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/pkg/utils"
+)
+
+// UpdatePresenceSettings 修改在线状态隐私设置。
+// @Summary 修改在线状态隐私设置
+// @Description 开启后其他用户看到的在线状态始终为离线，也不会收到最近在线时间；订阅者会立即收到状态变更。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param data body dot.PresenceSettingsData true "是否隐藏在线状态"
+// @Success 200 {object} utils.Response "修改成功"
+// @Failure 400 {object} utils.Response "请求参数错误"
+// @Router /chat/presence_settings [post]
+func (w *WebSockerRouter) UpdatePresenceSettings(c *gin.Context) {
+	var data dot.PresenceSettingsData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	user := middleware.CurrentUser(c)
+	if user.HidePresence == data.HidePresence {
+		utils.SuccessWithDefault(c, nil)
+		return
+	}
+
+	if err := w.chatUpdate.UserHidePresence(user.UUID, data.HidePresence); err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	go w.hub.PresenceVisibilityChanged(user.UUID, data.HidePresence)
+	utils.SuccessWithDefault(c, nil)
+}
@@ -0,0 +1,297 @@
+package chat
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"qianmianyao/MistChat-Server/internal/middleware"
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/models/entity"
+	"qianmianyao/MistChat-Server/internal/services/chat"
+	"qianmianyao/MistChat-Server/internal/websocket"
+	"qianmianyao/MistChat-Server/pkg/utils"
+)
+
+// isRoomOwner 判断用户是否为房间的房主
+func (w *WebSockerRouter) isRoomOwner(uuid, roomUUID string) bool {
+	role, err := w.chatFind.MemberRole(uuid, roomUUID)
+	return err == nil && role == entity.RoomRoleOwner
+}
+
+// GetRoomMembers 分页获取房间成员。
+// @Summary 获取房间成员
+// @Description 按加入时间分页返回房间成员的用户名、角色、加入时间与实时在线状态，只有房间成员可以查询。隐藏在线状态的成员始终显示为离线。
+// @Tags Chat
+// @Produce json
+// @Param uuid path string true "房间UUID"
+// @Param page query int false "页码，从 1 开始"
+// @Param page_size query int false "每页数量，默认 50，最大 100"
+// @Success 200 {object} utils.Response{data=dot.RoomMembersResponse} "成员列表"
+// @Failure 400 {object} utils.Response "请求参数错误"
+// @Failure 403 {object} utils.Response "不在房间内"
+// @Router /chat/rooms/{uuid}/members [get]
+func (w *WebSockerRouter) GetRoomMembers(c *gin.Context) {
+	var params dot.PageParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	roomUUID := c.Param("uuid")
+	if w.chatFind.IsTheUserIsInTheRoom(middleware.CurrentUser(c).UUID, roomUUID) == chat.NotInRoom {
+		utils.Forbidden(c, "不在房间内")
+		return
+	}
+
+	offset, limit := params.Normalize()
+	members, total, err := w.chatFind.RoomMembers(roomUUID, offset, limit)
+	if err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	infos := make([]dot.RoomMemberInfo, 0, len(members))
+	for _, member := range members {
+		infos = append(infos, dot.RoomMemberInfo{
+			UUID:     member.UUID,
+			Username: member.Username,
+			Role:     member.Role,
+			JoinTime: member.JoinTime,
+			Online:   !member.HidePresence && w.hub.IsOnline(member.UUID),
+		})
+	}
+	utils.SuccessWithDefault(c, dot.RoomMembersResponse{Members: infos, Total: total})
+}
+
+// GetRoomMessages 按游标分页获取房间消息历史。
+// @Summary 获取房间消息历史
+// @Description 返回房间内序号小于 before 的密文消息信封，按序号升序排列；before 为空时从最新一条开始。
+// @Description 只有房间的当前成员可以查询，响应中的 nextBefore 用于继续向前翻页。指定 thread 时只返回该话题内的回复。
+// @Tags Chat
+// @Produce json
+// @Param uuid path string true "房间UUID"
+// @Param thread query string false "话题根消息 ID"
+// @Param before query int false "只返回序号小于该值的消息"
+// @Param limit query int false "返回条数，默认 50，最大 100"
+// @Success 200 {object} utils.Response{data=dot.History} "消息历史"
+// @Failure 400 {object} utils.Response "请求参数错误"
+// @Failure 403 {object} utils.Response "不在房间内"
+// @Router /chat/rooms/{uuid}/messages [get]
+func (w *WebSockerRouter) GetRoomMessages(c *gin.Context) {
+	var params dot.HistoryParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+
+	history, err := w.hub.RoomHistory(middleware.CurrentUser(c).UUID, c.Param("uuid"), params.Thread, params.Before, params.Limit)
+	if err != nil {
+		if errors.Is(err, websocket.ErrNotInRoom) {
+			utils.Forbidden(c, "不在房间内")
+			return
+		}
+		utils.ErrorWithDefault(c)
+		return
+	}
+	utils.SuccessWithDefault(c, history)
+}
+
+// GetThreadUnread 获取房间内各话题的未读回复数。
+// @Summary 获取话题未读数
+// @Description 返回当前用户在房间内每个仍有未读回复的话题及其未读数，只有房间成员可以查询。
+// @Tags Chat
+// @Produce json
+// @Param uuid path string true "房间UUID"
+// @Success 200 {object} utils.Response{data=[]dot.ThreadUnread} "话题未读数"
+// @Failure 403 {object} utils.Response "不在房间内"
+// @Router /chat/rooms/{uuid}/threads/unread [get]
+func (w *WebSockerRouter) GetThreadUnread(c *gin.Context) {
+	uuid := middleware.CurrentUser(c).UUID
+	roomUUID := c.Param("uuid")
+	if w.chatFind.IsTheUserIsInTheRoom(uuid, roomUUID) == chat.NotInRoom {
+		utils.Forbidden(c, "不在房间内")
+		return
+	}
+
+	counts, err := w.chatFind.ThreadUnreadCounts(uuid, roomUUID)
+	if err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	unread := make([]dot.ThreadUnread, 0, len(counts))
+	for _, count := range counts {
+		unread = append(unread, dot.ThreadUnread{ThreadRoot: count.ThreadRoot, Unread: count.Unread})
+	}
+	utils.SuccessWithDefault(c, unread)
+}
+
+// LeaveRoom 离开房间。
+// @Summary 离开房间
+// @Description 当前用户离开房间，尚未投递的该房间离线消息随之清除。房主离开时房主身份自动转让给最早加入的管理员或成员，
+// @Description 最后一名成员离开后房间被删除。剩余成员会收到通知并重新分发 Sender Key。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param data body dot.RoomActionData true "房间UUID"
+// @Success 200 {object} utils.Response "已离开房间"
+// @Failure 400 {object} utils.Response "请求参数错误或不在房间内"
+// @Router /chat/leave_room [post]
+func (w *WebSockerRouter) LeaveRoom(c *gin.Context) {
+	var data dot.RoomActionData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	uuid := middleware.CurrentUser(c).UUID
+
+	result, err := w.chatDelete.RoomMember(uuid, data.RoomUUID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.Error(c, "不在房间内")
+			return
+		}
+		utils.ErrorWithDefault(c)
+		return
+	}
+
+	if !result.RoomDeleted {
+		w.hub.NotifyRoom(data.RoomUUID, dot.RoomMemberNotice{
+			Event:    dot.MemberLeftEvent,
+			RoomUUID: data.RoomUUID,
+			UUID:     uuid,
+			NewOwner: result.NewOwner,
+		})
+		go w.hub.ResetSenderKeys(data.RoomUUID)
+	} else {
+		w.hub.DeleteAttachmentContent(result.AttachmentIDs)
+	}
+	utils.SuccessWithDefault(c, nil)
+}
+
+// RenameRoom 修改房间名称。
+// @Summary 修改房间名称
+// @Description 房间管理员或房主修改房间名称，成员会收到 room_renamed 系统事件。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param data body dot.RenameRoomData true "房间UUID与新名称"
+// @Success 200 {object} utils.Response "修改成功"
+// @Failure 400 {object} utils.Response "请求参数错误或房间已归档"
+// @Failure 403 {object} utils.Response "没有权限"
+// @Router /chat/rename_room [post]
+func (w *WebSockerRouter) RenameRoom(c *gin.Context) {
+	var data dot.RenameRoomData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	uuid := middleware.CurrentUser(c).UUID
+	if !w.canManageRoom(uuid, data.RoomUUID) {
+		utils.Forbidden(c, "没有执行该操作的权限")
+		return
+	}
+	if w.chatFind.IsRoomArchived(data.RoomUUID) {
+		utils.Error(c, "房间已归档")
+		return
+	}
+
+	if err := w.chatUpdate.RoomName(data.RoomUUID, data.RoomName); err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	w.hub.NotifyRoom(data.RoomUUID, dot.RoomRenamedNotice{
+		Event:    dot.RoomRenamedEvent,
+		RoomUUID: data.RoomUUID,
+		Name:     data.RoomName,
+		Operator: uuid,
+	})
+	utils.SuccessWithDefault(c, nil)
+}
+
+// ArchiveRoom 归档房间。
+// @Summary 归档房间
+// @Description 房主归档房间，归档后房间只读：不再转发新消息，也不能加入。成员会收到通知。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param data body dot.RoomActionData true "房间UUID"
+// @Success 200 {object} utils.Response "已归档"
+// @Failure 400 {object} utils.Response "请求参数错误"
+// @Failure 403 {object} utils.Response "不是房主"
+// @Router /chat/archive_room [post]
+func (w *WebSockerRouter) ArchiveRoom(c *gin.Context) {
+	w.setRoomArchived(c, true)
+}
+
+// UnarchiveRoom 取消归档房间。
+// @Summary 取消归档房间
+// @Description 房主取消归档，房间恢复正常收发消息。成员会收到通知。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param data body dot.RoomActionData true "房间UUID"
+// @Success 200 {object} utils.Response "已取消归档"
+// @Failure 400 {object} utils.Response "请求参数错误"
+// @Failure 403 {object} utils.Response "不是房主"
+// @Router /chat/unarchive_room [post]
+func (w *WebSockerRouter) UnarchiveRoom(c *gin.Context) {
+	w.setRoomArchived(c, false)
+}
+
+func (w *WebSockerRouter) setRoomArchived(c *gin.Context, archived bool) {
+	var data dot.RoomActionData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	uuid := middleware.CurrentUser(c).UUID
+	if !w.isRoomOwner(uuid, data.RoomUUID) {
+		utils.Forbidden(c, "只有房主可以执行该操作")
+		return
+	}
+
+	if err := w.chatUpdate.RoomArchived(data.RoomUUID, archived); err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	event := dot.RoomArchivedEvent
+	if !archived {
+		event = dot.RoomUnarchivedEvent
+	}
+	w.hub.NotifyRoom(data.RoomUUID, dot.RoomLifecycleNotice{Event: event, RoomUUID: data.RoomUUID, Operator: uuid})
+	utils.SuccessWithDefault(c, nil)
+}
+
+// DeleteRoom 删除房间。
+// @Summary 删除房间
+// @Description 房主删除房间，房间、成员关系与邀请被软删除，未投递的离线消息被清除，之后不再向任何成员转发该房间的消息。
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param data body dot.RoomActionData true "房间UUID"
+// @Success 200 {object} utils.Response "已删除"
+// @Failure 400 {object} utils.Response "请求参数错误"
+// @Failure 403 {object} utils.Response "不是房主"
+// @Router /chat/delete_room [post]
+func (w *WebSockerRouter) DeleteRoom(c *gin.Context) {
+	var data dot.RoomActionData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.Error(c, "参数错误")
+		return
+	}
+	uuid := middleware.CurrentUser(c).UUID
+	if !w.isRoomOwner(uuid, data.RoomUUID) {
+		utils.Forbidden(c, "只有房主可以执行该操作")
+		return
+	}
+
+	// 删除后成员关系不再可查，先记录需要通知的成员
+	members := w.chatFind.AllUsersInTheRoom(data.RoomUUID)
+	attachmentIDs, err := w.chatDelete.Room(data.RoomUUID)
+	if err != nil {
+		utils.ErrorWithDefault(c)
+		return
+	}
+	w.hub.DeleteAttachmentContent(attachmentIDs)
+	w.hub.NotifyUsers(members, "", dot.RoomLifecycleNotice{Event: dot.RoomDeletedEvent, RoomUUID: data.RoomUUID, Operator: uuid})
+	utils.SuccessWithDefault(c, nil)
+}
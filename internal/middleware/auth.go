@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"qianmianyao/MistChat-Server/internal/models/entity"
+	"qianmianyao/MistChat-Server/internal/services/chat"
+	"qianmianyao/MistChat-Server/pkg/config"
+	"qianmianyao/MistChat-Server/pkg/encryption"
+	"qianmianyao/MistChat-Server/pkg/utils"
+)
+
+// chatUserKey 认证通过后在 gin.Context 中保存当前用户的键
+const chatUserKey = "chatUser"
+
+// Auth 校验访问令牌并将对应的 ChatUser 写入上下文。
+// 令牌优先从 Authorization: Bearer 头读取；浏览器 WebSocket 无法设置请求头，因此也接受 token 查询参数。
+func Auth() gin.HandlerFunc {
+	chatFind := chat.NewFind()
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" {
+			token = c.Query("token")
+		}
+		if token == "" {
+			utils.Unauthorized(c, "缺少访问令牌")
+			return
+		}
+
+		claims, err := encryption.ParseToken(token, encryption.AccessToken, []byte(config.GetConfig().Auth.Secret))
+		if err != nil {
+			if errors.Is(err, encryption.ErrTokenExpired) {
+				utils.Unauthorized(c, "访问令牌已过期")
+				return
+			}
+			utils.Unauthorized(c, "无效的访问令牌")
+			return
+		}
+
+		user, err := chatFind.ChatUserByUUID(claims.UUID)
+		if err != nil {
+			utils.Unauthorized(c, "用户不存在")
+			return
+		}
+
+		c.Set(chatUserKey, user)
+		c.Next()
+	}
+}
+
+// CurrentUser 返回经 Auth 中间件认证的当前用户
+func CurrentUser(c *gin.Context) entity.ChatUser {
+	return c.MustGet(chatUserKey).(entity.ChatUser)
+}
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 type DatabaseConfig struct {
 	User     string
 	Password string
@@ -17,7 +19,46 @@ type LogConfig struct {
 	Stacktrace  bool     `mapstructure:"stacktrace"`
 }
 
+// AuthConfig 会话令牌相关配置
+type AuthConfig struct {
+	Secret          string        `mapstructure:"secret"`            // 令牌签名密钥
+	AccessTokenTTL  time.Duration `mapstructure:"access_token_ttl"`  // 访问令牌有效期
+	RefreshTokenTTL time.Duration `mapstructure:"refresh_token_ttl"` // 刷新令牌有效期
+}
+
+// SignalConfig Signal 密钥管理相关配置
+type SignalConfig struct {
+	PreKeyLowThreshold        int64         `mapstructure:"prekey_low_threshold"`         // 一次性预密钥剩余数量低于该值时提醒客户端补充
+	SignedPreKeyValidity      time.Duration `mapstructure:"signed_prekey_validity"`       // 签名预密钥的有效期
+	SignedPreKeyGracePeriod   time.Duration `mapstructure:"signed_prekey_grace_period"`   // 新签名预密钥上传后旧密钥继续有效的时长
+	SignedPreKeyExpiryWarning time.Duration `mapstructure:"signed_prekey_expiry_warning"` // 签名预密钥到期前多久提醒客户端轮换
+	SignedPreKeyCheckInterval time.Duration `mapstructure:"signed_prekey_check_interval"` // 后台检查签名预密钥的间隔
+}
+
+// RoomConfig 房间相关配置
+type RoomConfig struct {
+	JoinFailureWindow      time.Duration `mapstructure:"join_failure_window"`        // 统计加入房间失败次数的时间窗口
+	JoinMaxFailuresPerUser int           `mapstructure:"join_max_failures_per_user"` // 窗口内单个用户对单个房间允许的密码错误次数
+	JoinMaxFailuresPerIP   int           `mapstructure:"join_max_failures_per_ip"`   // 窗口内单个 IP 允许的密码错误次数
+}
+
+// StorageConfig 附件存储相关配置
+type StorageConfig struct {
+	Backend          string        `mapstructure:"backend"`            // 存储后端，目前支持 local
+	LocalPath        string        `mapstructure:"local_path"`         // local 后端的根目录
+	ChunkSize        int64         `mapstructure:"chunk_size"`         // 分片上传时除最后一片外每片的字节数
+	MaxFileSize      int64         `mapstructure:"max_file_size"`      // 单个附件的最大字节数
+	MaxThumbnailSize int64         `mapstructure:"max_thumbnail_size"` // 单个缩略图的最大字节数
+	UserQuota        int64         `mapstructure:"user_quota"`         // 单个用户所有附件的总字节数上限
+	DownloadURLTTL   time.Duration `mapstructure:"download_url_ttl"`   // 签名下载链接的有效期
+	UploadTTL        time.Duration `mapstructure:"upload_ttl"`         // 登记后超过该时长仍未完成的上传会被清理
+}
+
 type Config struct {
 	Database DatabaseConfig
-	Log      LogConfig `mapstructure:"log"`
+	Log      LogConfig     `mapstructure:"log"`
+	Auth     AuthConfig    `mapstructure:"auth"`
+	Signal   SignalConfig  `mapstructure:"signal"`
+	Room     RoomConfig    `mapstructure:"room"`
+	Storage  StorageConfig `mapstructure:"storage"`
 }
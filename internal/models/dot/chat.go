@@ -1,14 +1,21 @@
 package dot
 
+import "time"
+
+// DefaultDeviceId 用户注册时自动登记的主设备号，未指定设备时使用
+const DefaultDeviceId = 1
+
 type Address struct {
 	UUID     string `json:"uuid,omitempty"`
 	DeviceId int    `json:"deviceId,omitempty"`
 }
 
+// SignedPreKey 签名预密钥。作为请求体的字段时公钥与签名必填，嵌套结构体上的 required 标签不会被校验
 type SignedPreKey struct {
-	Id        int    `json:"id"`
-	PublicKey string `json:"publicKey"`
-	Signature string `json:"signature"`
+	Id         int    `json:"id"`
+	PublicKey  string `json:"publicKey" binding:"required"`
+	Signature  string `json:"signature" binding:"required"`
+	ValidUntil int64  `json:"validUntil,omitempty"` // 服务端返回的有效期截止 Unix 时间戳（秒）
 }
 
 type PreKey struct {
@@ -19,19 +26,17 @@ type PreKey struct {
 type SignalData struct {
 	Address        *Address     `json:"address,omitempty"`
 	RegistrationId int          `json:"registrationId"`
-	IdentityKey    string       `json:"identityKey"`
-	SignedPreKey   SignedPreKey `json:"signedPreKey"`
-	PreKey         PreKey       `json:"preKey"`
+	IdentityKey    string       `json:"identityKey" binding:"required"`
+	SignedPreKey   SignedPreKey `json:"signedPreKey"`     // 签名预密钥只取自该字段，与可选的一次性预密钥无关
+	PreKey         *PreKey      `json:"preKey,omitempty"` // 一次性预密钥池为空且没有兜底密钥时为空
 }
 
 type JoinRoomData struct {
 	RoomUUID string `json:"room_uuid" binding:"required"`
-	UserUUID string `json:"user_uuid" binding:"required"`
 	Password string `json:"password"`
 }
 
 type CreateRoomData struct {
-	UserUUID string `json:"user_uuid" binding:"required"`
 	RoomName string `json:"room_name" binding:"required"`
 	Password string `json:"password"`
 }
@@ -40,11 +45,206 @@ type RegisterData struct {
 	Username string `json:"username" binding:"required"`
 }
 
+type TokenResponse struct {
+	AccessToken          string    `json:"access_token"`
+	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
+	RefreshToken         string    `json:"refresh_token"`
+}
+
 type RegisterResponse struct {
 	Username string `json:"username"`
 	UUID     string `json:"uuid"`
+	DeviceId int    `json:"device_id"`
+	TokenResponse
+}
+
+type RefreshTokenData struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type RegisterDeviceData struct {
+	Name string `json:"name" binding:"max=64"`
+}
+
+type DeviceInfo struct {
+	DeviceId   int        `json:"device_id"`
+	Name       string     `json:"name"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// DeviceParams 指定目标设备的查询参数，缺省为主设备
+type DeviceParams struct {
+	DeviceId int `form:"device_id"`
+}
+
+type UploadPreKeysData struct {
+	DeviceId         int      `json:"device_id"`
+	PreKeys          []PreKey `json:"pre_keys" binding:"max=100"`
+	LastResortPreKey *PreKey  `json:"last_resort_pre_key,omitempty"` // 可选：替换设备的兜底密钥
+}
+
+type PreKeyCountResponse struct {
+	DeviceId  int   `json:"device_id"`
+	Remaining int64 `json:"remaining"`
+}
+
+type UploadSignedPreKeyData struct {
+	DeviceId     int          `json:"device_id"`
+	SignedPreKey SignedPreKey `json:"signed_pre_key"`
+}
+
+type ReplaceIdentityKeyData struct {
+	DeviceId       int          `json:"device_id"`
+	RegistrationId int          `json:"registration_id" binding:"required"`
+	IdentityKey    string       `json:"identity_key" binding:"required"`
+	SignedPreKey   SignedPreKey `json:"signed_pre_key"`
+	PreKeys        []PreKey     `json:"pre_keys" binding:"max=100"`
+}
+
+type SenderKeyStatusParams struct {
+	RoomUUID       string `form:"room_uuid" binding:"required"`
+	DistributionId string `form:"distribution_id" binding:"required"`
+	Generation     int    `form:"generation"`
+}
+
+type SenderKeyStatusResponse struct {
+	Missing        []string         `json:"missing"`        // 至少有一台设备尚未收到该 Sender Key 的房间成员
+	MissingDevices map[string][]int `json:"missingDevices"` // 按成员列出尚未收到该 Sender Key 的设备号
+}
+
+type ModerationData struct {
+	RoomUUID   string `json:"room_uuid" binding:"required"`
+	TargetUUID string `json:"target_uuid" binding:"required"`
+	Reason     string `json:"reason" binding:"max=255"`
+}
+
+type CreateInviteData struct {
+	RoomUUID  string `json:"room_uuid" binding:"required"`
+	MaxUses   int    `json:"max_uses" binding:"min=0"`   // 0 表示不限次数
+	ExpiresIn int64  `json:"expires_in" binding:"min=0"` // 有效时长（秒），0 表示永不过期
+}
+
+type JoinByInviteData struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type RevokeInviteData struct {
+	RoomUUID string `json:"room_uuid" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type ListInvitesParams struct {
+	RoomUUID string `form:"room_uuid" binding:"required"`
+}
+
+type RoomInviteInfo struct {
+	Code      string     `json:"code"`
+	RoomUUID  string     `json:"room_uuid"`
+	CreatedBy string     `json:"created_by"`
+	MaxUses   int        `json:"max_uses"`
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type RoomActionData struct {
+	RoomUUID string `json:"room_uuid" binding:"required"`
+}
+
+type RenameRoomData struct {
+	RoomUUID string `json:"room_uuid" binding:"required"`
+	RoomName string `json:"room_name" binding:"required,max=64"`
+}
+
+// DefaultPageSize 分页查询未指定 page_size 时的默认值
+const DefaultPageSize = 50
+
+// PageParams 分页查询参数，page 从 1 开始
+type PageParams struct {
+	Page     int `form:"page" binding:"min=0"`
+	PageSize int `form:"page_size" binding:"min=0,max=100"`
+}
+
+// Normalize 为未指定的分页参数填充默认值，返回查询使用的 offset 与 limit
+func (p PageParams) Normalize() (offset, limit int) {
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	if p.PageSize < 1 {
+		p.PageSize = DefaultPageSize
+	}
+	return (p.Page - 1) * p.PageSize, p.PageSize
+}
+
+type RoomMemberInfo struct {
+	UUID     string    `json:"uuid"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	JoinTime time.Time `json:"join_time"`
+	Online   bool      `json:"online"` // 由当前连接状态实时计算
+}
+
+type RoomMembersResponse struct {
+	Members []RoomMemberInfo `json:"members"`
+	Total   int64            `json:"total"`
+}
+
+type PresenceSettingsData struct {
+	HidePresence bool `json:"hide_presence"`
+}
+
+// HistoryParams 房间消息历史的游标分页参数，before 为 0 时从最新一条开始
+type HistoryParams struct {
+	Thread string `form:"thread"` // 话题根消息 ID，为空时查询整个房间
+	Before int64  `form:"before" binding:"min=0"`
+	Limit  int    `form:"limit" binding:"min=0,max=100"`
+}
+
+// ThreadUnread 某个话题内当前用户尚未读的回复数
+type ThreadUnread struct {
+	ThreadRoot string `json:"threadRoot"`
+	Unread     int64  `json:"unread"`
+}
+
+// CreateAttachmentData 登记附件分片上传的请求
+type CreateAttachmentData struct {
+	RoomUUID  string         `json:"room_uuid" binding:"required"`
+	Size      int64          `json:"size" binding:"required,min=1"` // 客户端加密后密文的总字节数
+	MimeType  string         `json:"mime_type" binding:"max=128"`
+	Plaintext bool           `json:"plaintext"`                        // 未加密上传，服务端会校验 MIME 类型与尺寸
+	Width     int            `json:"width" binding:"min=0,max=16384"`  // 图片或视频的宽度
+	Height    int            `json:"height" binding:"min=0,max=16384"` // 图片或视频的高度
+	Thumbnail *ThumbnailData `json:"thumbnail"`                        // 可选的缩略图，总是按密文处理
+}
+
+// ThumbnailData 随附件一同登记的缩略图
+type ThumbnailData struct {
+	Size     int64  `json:"size" binding:"required,min=1"`
+	MimeType string `json:"mime_type" binding:"max=128"`
+}
+
+// AttachmentUpload 附件的上传进度，客户端据此从 next_part 继续上传
+type AttachmentUpload struct {
+	AttachmentID string `json:"attachment_id"`
+	Size         int64  `json:"size"`
+	Received     int64  `json:"received"`
+	ChunkSize    int64  `json:"chunk_size"` // 除最后一片外每片必须恰好为该字节数
+	NextPart     int    `json:"next_part"`
+	Completed    bool   `json:"completed"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+
+	Thumbnail *AttachmentUpload `json:"thumbnail,omitempty"` // 缩略图的上传进度，使用相同的分片接口上传
+}
+
+// AttachmentURL 附件的限时签名下载链接
+type AttachmentURL struct {
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"` // 缩略图上传完成后返回
+	ExpiresAt    time.Time `json:"expires_at"`
 }
 
-type GetUsersRoomsParams struct {
-	UserUUID string `form:"user_uuid" binding:"required"`
+type DownloadParams struct {
+	Expires   int64  `form:"expires" binding:"required"`
+	Signature string `form:"signature" binding:"required"`
 }
@@ -0,0 +1,133 @@
+package dot
+
+import "time"
+
+// SystemEventType 系统消息携带的事件类型，客户端据此解析 Content.Data 的结构
+type SystemEventType string
+
+const (
+	ConnectedEvent SystemEventType = "connected" // 连接建立成功
+
+	PreKeyLowEvent            SystemEventType = "prekey_low"
+	SignedPreKeyExpiringEvent SystemEventType = "signed_prekey_expiring"
+	IdentityKeyChangedEvent   SystemEventType = "identity_key_changed"
+	SenderKeyResetEvent       SystemEventType = "sender_key_reset"
+
+	MemberJoinedEvent      SystemEventType = "member_joined"
+	MemberLeftEvent        SystemEventType = "member_left"
+	MemberKickedEvent      SystemEventType = "member_kicked"
+	MemberBannedEvent      SystemEventType = "member_banned"
+	MemberUnbannedEvent    SystemEventType = "member_unbanned"
+	MemberRoleChangedEvent SystemEventType = "member_role_changed"
+	ModerationFailedEvent  SystemEventType = "moderation_failed"
+
+	RoomRenamedEvent    SystemEventType = "room_renamed"
+	RoomArchivedEvent   SystemEventType = "room_archived"
+	RoomUnarchivedEvent SystemEventType = "room_unarchived"
+	RoomDeletedEvent    SystemEventType = "room_deleted"
+
+	UserOnlineEvent  SystemEventType = "user_online"
+	UserOfflineEvent SystemEventType = "user_offline"
+)
+
+// SystemEvent 系统消息的结构化负载，序列化后放在 Content.Data 中，每种负载都带有 event 字段
+type SystemEvent interface {
+	EventType() SystemEventType
+}
+
+// ConnectedNotice 连接建立后推送给该连接的欢迎通知
+type ConnectedNotice struct {
+	Event    SystemEventType `json:"event"`
+	UUID     string          `json:"uuid"`
+	DeviceId int             `json:"device_id"`
+}
+
+// PreKeyLowNotice 一次性预密钥不足时推送给设备的系统通知
+type PreKeyLowNotice struct {
+	Event     SystemEventType `json:"event"`
+	DeviceId  int             `json:"device_id"`
+	Remaining int64           `json:"remaining"`
+	Threshold int64           `json:"threshold"`
+}
+
+// SignedPreKeyExpiringNotice 当前签名预密钥即将到期时推送给设备的系统通知
+type SignedPreKeyExpiringNotice struct {
+	Event          SystemEventType `json:"event"`
+	DeviceId       int             `json:"device_id"`
+	SignedPreKeyId int             `json:"signed_pre_key_id"`
+	ValidUntil     int64           `json:"valid_until"`
+}
+
+// IdentityKeyChangedNotice 用户某台设备的身份密钥被替换时推送给相关用户的系统通知，客户端据此提示安全码已变更
+type IdentityKeyChangedNotice struct {
+	Event    SystemEventType `json:"event"`
+	UUID     string          `json:"uuid"`
+	DeviceId int             `json:"device_id"`
+}
+
+// SenderKeyResetNotice 房间成员变动后推送给所有成员的系统通知，客户端需生成新的 Sender Key 并重新分发
+type SenderKeyResetNotice struct {
+	Event    SystemEventType `json:"event"`
+	RoomUUID string          `json:"room_uuid"`
+}
+
+// RoomMemberNotice 成员加入或离开房间时推送给房间成员的系统通知
+type RoomMemberNotice struct {
+	Event    SystemEventType `json:"event"`
+	RoomUUID string          `json:"room_uuid"`
+	UUID     string          `json:"uuid"`
+	NewOwner string          `json:"new_owner,omitempty"` // 房主离开时接任的成员
+}
+
+// RoomModerationNotice 房间管理操作完成后推送给房间成员及被操作者的系统通知
+type RoomModerationNotice struct {
+	Event    SystemEventType `json:"event"`
+	RoomUUID string          `json:"room_uuid"`
+	Action   string          `json:"action"`
+	Operator string          `json:"operator"`
+	Target   string          `json:"target"`
+	Reason   string          `json:"reason,omitempty"`
+}
+
+// ModerationFailedNotice 通过 WebSocket 发起的管理操作失败时回复给发起连接的系统通知
+type ModerationFailedNotice struct {
+	Event    SystemEventType `json:"event"`
+	RoomUUID string          `json:"room_uuid"`
+	Action   string          `json:"action"`
+	Target   string          `json:"target"`
+	Error    string          `json:"error"`
+}
+
+// RoomRenamedNotice 房间改名后推送给房间成员的系统通知
+type RoomRenamedNotice struct {
+	Event    SystemEventType `json:"event"`
+	RoomUUID string          `json:"room_uuid"`
+	Name     string          `json:"name"`
+	Operator string          `json:"operator"`
+}
+
+// RoomLifecycleNotice 房间被归档、取消归档或删除时推送给成员的系统通知
+type RoomLifecycleNotice struct {
+	Event    SystemEventType `json:"event"`
+	RoomUUID string          `json:"room_uuid"`
+	Operator string          `json:"operator"`
+}
+
+// PresenceNotice 用户上线或离线时推送给订阅者的系统通知，订阅时也会以该通知返回当前状态
+type PresenceNotice struct {
+	Event      SystemEventType `json:"event"`
+	UUID       string          `json:"uuid"`
+	LastSeenAt *time.Time      `json:"last_seen_at,omitempty"` // 仅离线时携带，隐藏在线状态的用户不返回
+}
+
+func (n ConnectedNotice) EventType() SystemEventType            { return n.Event }
+func (n PreKeyLowNotice) EventType() SystemEventType            { return n.Event }
+func (n SignedPreKeyExpiringNotice) EventType() SystemEventType { return n.Event }
+func (n IdentityKeyChangedNotice) EventType() SystemEventType   { return n.Event }
+func (n SenderKeyResetNotice) EventType() SystemEventType       { return n.Event }
+func (n RoomMemberNotice) EventType() SystemEventType           { return n.Event }
+func (n RoomModerationNotice) EventType() SystemEventType       { return n.Event }
+func (n ModerationFailedNotice) EventType() SystemEventType     { return n.Event }
+func (n RoomRenamedNotice) EventType() SystemEventType          { return n.Event }
+func (n RoomLifecycleNotice) EventType() SystemEventType        { return n.Event }
+func (n PresenceNotice) EventType() SystemEventType             { return n.Event }
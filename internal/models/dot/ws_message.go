@@ -1,6 +1,9 @@
 package dot
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type MessageType string
 
@@ -10,6 +13,29 @@ const (
 	VideoMessage  MessageType = "video"
 	FileMessage   MessageType = "file"
 	SystemMessage MessageType = "system"
+	AckMessage    MessageType = "ack"
+	// DeliveredMessage 与 ReadMessage 是回执类型，由接收者发出并转发给原发送者
+	DeliveredMessage MessageType = "delivered"
+	ReadMessage      MessageType = "read"
+	// SenderKeyDistributionMessage 携带成对加密的 Sender Key 分发消息，只路由给房间内的指定成员
+	SenderKeyDistributionMessage MessageType = "sender_key_distribution"
+	// ModerationMessage 房间管理命令，Destination 为目标房间
+	ModerationMessage MessageType = "moderation"
+	// PresenceSubscribeMessage 与 PresenceUnsubscribeMessage 订阅或取消订阅同房间用户的在线状态
+	PresenceSubscribeMessage   MessageType = "presence_subscribe"
+	PresenceUnsubscribeMessage MessageType = "presence_unsubscribe"
+	// TypingStartMessage 与 TypingStopMessage 是临时的输入状态，只转发给在线的房间成员，不持久化也不进入离线队列
+	TypingStartMessage MessageType = "typing_start"
+	TypingStopMessage  MessageType = "typing_stop"
+	// ServerAckMessage 服务端受理消息后回复给发送连接，携带分配的消息 ID 与房间序号
+	ServerAckMessage MessageType = "server_ack"
+	// HistoryMessage 客户端请求房间消息历史，服务端以同类型消息回复
+	HistoryMessage MessageType = "history"
+	// EditMessage 与 DeleteMessage 引用此前的服务端消息 ID，编辑或为所有人撤回该消息
+	EditMessage   MessageType = "edit"
+	DeleteMessage MessageType = "delete"
+	// ReactionMessage 对房间消息添加或取消表情回应
+	ReactionMessage MessageType = "reaction"
 )
 
 type Source struct {
@@ -18,7 +44,8 @@ type Source struct {
 }
 
 type Attachment struct {
-	URL    string `json:"url"`
+	Id     string `json:"id"` // 上传接口分配的附件 ID，下载链接需按 ID 另行获取
+	URL    string `json:"url,omitempty"`
 	Type   string `json:"type"`
 	Name   string `json:"name"`
 	Size   int64  `json:"size"`
@@ -26,10 +53,90 @@ type Attachment struct {
 	Height int    `json:"height,omitempty"`
 }
 
+// Ack 客户端对离线消息的确认，QueueIds 对应服务端投递时附带的 queueId
+type Ack struct {
+	QueueIds []uint `json:"queueIds"`
+}
+
+// Receipt 回执引用的服务端消息 ID
+type Receipt struct {
+	MessageIds []string `json:"messageIds"`
+}
+
+// SenderKeyDistribution 描述一次 Sender Key 分发，分发消息的密文本身放在 Content.Text 中
+type SenderKeyDistribution struct {
+	Recipient         string `json:"recipient"`                   // 接收该分发消息的房间成员 UID
+	RecipientDeviceId int    `json:"recipientDeviceId,omitempty"` // 分发消息按设备成对加密，只投递给该设备，缺省为主设备
+	DistributionId    string `json:"distributionId"`              // 发送者在该房间的 Sender Key 分发 ID
+	Generation        int    `json:"generation"`                  // Sender Key 的代数，轮换时递增
+}
+
+// Moderation 房间管理命令：kick / ban / unban / promote / demote / transfer
+type Moderation struct {
+	Action string `json:"action"`
+	Target string `json:"target"` // 被操作成员的 UID
+	Reason string `json:"reason,omitempty"`
+}
+
+// PresenceSubscription 在线状态订阅涉及的用户 UID
+type PresenceSubscription struct {
+	Users []string `json:"users"`
+}
+
+// ServerAck 服务端对客户端消息的受理结果，Nonce 原样回传客户端发送时填写的值
+type ServerAck struct {
+	Nonce string `json:"nonce"`
+	Id    string `json:"id,omitempty"`    // 服务端分配的消息 ID
+	Seq   int64  `json:"seq,omitempty"`   // 房间内的消息序号
+	Error string `json:"error,omitempty"` // 消息被拒绝时的原因
+}
+
+// Reaction 对房间消息添加或取消表情回应。
+// 服务端按 Emoji 原值去重与计数，只有明文表情才能正确聚合；每次加密结果不同的密文会被计为不同的表情。
+type Reaction struct {
+	MessageId string `json:"messageId"`
+	Emoji     string `json:"emoji"`            // 明文表情，服务端按原值计数
+	Remove    bool   `json:"remove,omitempty"` // 为 true 时取消该表情回应
+}
+
+// ReactionCount 某条消息上某个表情的回应人数
+type ReactionCount struct {
+	Emoji   string `json:"emoji"`
+	Count   int64  `json:"count"`
+	Reacted bool   `json:"reacted,omitempty"` // 请求者本人是否回应过该表情
+}
+
+// History 房间消息历史的请求与回复。
+// 请求时填写 Before 与 Limit；回复时 Messages 按序号升序排列，NextBefore 为继续向前翻页使用的游标。
+type History struct {
+	Thread     string                     `json:"thread,omitempty"` // 话题根消息 ID，为空时查询整个房间
+	Before     int64                      `json:"before,omitempty"`
+	Limit      int                        `json:"limit,omitempty"`
+	Messages   []json.RawMessage          `json:"messages,omitempty"`
+	NextBefore int64                      `json:"nextBefore,omitempty"`
+	HasMore    bool                       `json:"hasMore,omitempty"`
+	Reactions  map[string][]ReactionCount `json:"reactions,omitempty"` // 按消息 ID 聚合的表情回应
+	Error      string                     `json:"error,omitempty"`     // 请求被拒绝时的原因
+}
+
+// MessageRef 引用房间内此前的一条消息
+type MessageRef struct {
+	MessageId string `json:"messageId"`
+}
+
 type Content struct {
-	Text       string      `json:"text,omitempty"`
-	Data       interface{} `json:"data,omitempty"`
-	Attachment *Attachment `json:"attachment,omitempty"`
+	Text       string                 `json:"text,omitempty"`
+	Data       SystemEvent            `json:"data,omitempty"` // 系统消息的结构化事件，只由服务端发出
+	Attachment *Attachment            `json:"attachment,omitempty"`
+	Ack        *Ack                   `json:"ack,omitempty"`
+	Receipt    *Receipt               `json:"receipt,omitempty"`
+	SenderKey  *SenderKeyDistribution `json:"senderKey,omitempty"`
+	Moderation *Moderation            `json:"moderation,omitempty"`
+	Presence   *PresenceSubscription  `json:"presence,omitempty"`
+	ServerAck  *ServerAck             `json:"serverAck,omitempty"`
+	History    *History               `json:"history,omitempty"`
+	Ref        *MessageRef            `json:"ref,omitempty"` // edit / delete 引用的消息
+	Reaction   *Reaction              `json:"reaction,omitempty"`
 }
 
 type DataMessage struct {
@@ -43,9 +150,16 @@ type ReadStatus struct {
 }
 
 type Envelope struct {
+	Id          string      `json:"id,omitempty"`         // 服务端分配的消息 ID
+	Seq         int64       `json:"seq,omitempty"`        // 服务端分配的房间内消息序号，单调递增
+	Nonce       string      `json:"nonce,omitempty"`      // 客户端生成的随机值，服务端在 server_ack 中原样回传
+	EditedAt    *time.Time  `json:"editedAt,omitempty"`   // 消息被编辑后由服务端填写
+	ReplyTo     string      `json:"replyTo,omitempty"`    // 回复的消息 ID，必须属于同一房间
+	ThreadRoot  string      `json:"threadRoot,omitempty"` // 所属话题的根消息 ID，根消息本身不能位于话题内
 	Source      Source      `json:"source"`
 	Message     DataMessage `json:"message"`
 	ReadStatus  *ReadStatus `json:"readStatus,omitempty"`
 	Destination string      `json:"destination"`
 	Timestamp   time.Time   `json:"timestamp"`
+	QueueId     uint        `json:"queueId,omitempty"` // 离线投递时由服务端填写，客户端需回传 ack
 }
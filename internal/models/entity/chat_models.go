@@ -10,44 +10,176 @@ type ChatUser struct {
 	UUID     string `gorm:"uniqueIndex;not null"`
 	Username string `gorm:"not null"`
 	IsOnline bool   `gorm:"not null;default:false"`
+
+	LastSeenAt   *time.Time // 最后一台设备断开连接的时间
+	HidePresence bool       `gorm:"not null;default:false"` // 隐私设置：对他人隐藏在线状态与最近在线时间
+
+	RefreshTokenID string `gorm:"type:varchar(64);not null;default:''"` // 当前有效的刷新令牌标识，刷新时轮换，旧令牌随之失效
+}
+
+// Device 用户的一台登录设备，DeviceID 在同一用户内从 1 开始递增
+type Device struct {
+	gorm.Model
+	ChatUserUUID string     `gorm:"type:varchar(64);not null;uniqueIndex:idx_device_user_device"`
+	DeviceID     int        `gorm:"not null;uniqueIndex:idx_device_user_device"`
+	Name         string     `gorm:"type:varchar(64)"`
+	LastSeenAt   *time.Time // 该设备最近一次断开连接的时间
 }
 
 type Room struct {
 	gorm.Model
-	UUID      string `gorm:"uniqueIndex;not null"`
-	Name      string `gorm:"not null"`
-	Password  string `gorm:"column:password" json:"-"`
-	Isprivate bool   `gorm:"not null,default:false"`
+	UUID       string     `gorm:"uniqueIndex;not null"`
+	Name       string     `gorm:"not null"`
+	Password   string     `gorm:"column:password" json:"-"`
+	Isprivate  bool       `gorm:"not null,default:false"`
+	ArchivedAt *time.Time // 归档后房间只读，不再接收新消息与新成员
+	LastSeq    int64      `gorm:"not null;default:0"` // 房间内最近分配的消息序号
 }
 
+// 房间成员角色，权限依次递减
+const (
+	RoomRoleOwner  = "owner"
+	RoomRoleAdmin  = "admin"
+	RoomRoleMember = "member"
+)
+
+// RoomMembers 房间成员关系，同一用户在同一房间只有一条未删除的记录
 type RoomMembers struct {
 	gorm.Model
-	RoomUUID     string    `gorm:"index;not null"`
-	ChatUserUUID string    `gorm:"index;not null"`
+	RoomUUID     string    `gorm:"index;not null;uniqueIndex:idx_room_member_room_user,where:deleted_at IS NULL"`
+	ChatUserUUID string    `gorm:"index;not null;uniqueIndex:idx_room_member_room_user,where:deleted_at IS NULL"`
 	JoinTime     time.Time `gorm:"not null"`
+	Role         string    `gorm:"type:varchar(16);not null;default:member"` // owner / admin / member
+}
+
+// RoomBan 房间封禁记录，被封禁的用户无法加入房间或在房间内发言
+type RoomBan struct {
+	gorm.Model
+	RoomUUID     string `gorm:"type:varchar(64);not null;uniqueIndex:idx_room_ban_room_user"`
+	ChatUserUUID string `gorm:"type:varchar(64);not null;uniqueIndex:idx_room_ban_room_user"`
+	BannedBy     string `gorm:"type:varchar(64);not null"`
+	Reason       string `gorm:"type:varchar(255)"`
+}
+
+// RoomInvite 房间邀请码，持有者无需密码即可加入房间；撤销时软删除
+type RoomInvite struct {
+	gorm.Model
+	Code      string     `gorm:"type:varchar(64);uniqueIndex;not null"` // GenerateRandomID 生成的 i_ 邀请码
+	RoomUUID  string     `gorm:"type:varchar(64);not null;index"`
+	CreatedBy string     `gorm:"type:varchar(64);not null"`
+	MaxUses   int        `gorm:"not null;default:0"` // 0 表示不限次数
+	Uses      int        `gorm:"not null;default:0"`
+	ExpiresAt *time.Time // 为空表示永不过期
+}
+
+// RoomMessage 房间消息历史，原样保存服务端盖章后的密文信封，服务端无法解密
+type RoomMessage struct {
+	gorm.Model
+	MessageID  string `gorm:"type:varchar(64);not null;uniqueIndex"`
+	RoomUUID   string `gorm:"type:varchar(64);not null;uniqueIndex:idx_room_message_room_seq"`
+	Seq        int64  `gorm:"not null;uniqueIndex:idx_room_message_room_seq"`
+	SenderUUID string `gorm:"type:varchar(64);not null"`
+	ReplyTo    string `gorm:"type:varchar(64)"`       // 回复的消息 ID，为空表示不是回复
+	ThreadRoot string `gorm:"type:varchar(64);index"` // 所属话题的根消息 ID，为空表示不在话题内
+	Envelope   string `gorm:"type:text;not null"`
+}
+
+// MessageReaction 用户对房间消息的表情回应，同一用户对同一消息的同一表情只记录一次；取消时物理删除
+type MessageReaction struct {
+	gorm.Model
+	MessageID    string `gorm:"type:varchar(64);not null;uniqueIndex:idx_reaction_message_user_emoji"`
+	ChatUserUUID string `gorm:"type:varchar(64);not null;uniqueIndex:idx_reaction_message_user_emoji"`
+	Emoji        string `gorm:"type:varchar(256);not null;uniqueIndex:idx_reaction_message_user_emoji"` // 明文表情，按原值去重计数
+	RoomUUID     string `gorm:"type:varchar(64);not null;index"`
+}
+
+// Attachment 分片上传的附件，服务端只保存客户端加密后的密文，合并完成前 CompletedAt 为空
+type Attachment struct {
+	gorm.Model
+	AttachmentID string `gorm:"type:varchar(64);not null;uniqueIndex"`
+	OwnerUUID    string `gorm:"type:varchar(64);not null;index"`
+	RoomUUID     string `gorm:"type:varchar(64);not null;index"` // 附件所属房间，只有房间成员可以获取下载链接
+	MimeType     string `gorm:"type:varchar(128)"`
+	Size         int64  `gorm:"not null"`           // 上传前声明的总字节数，计入配额
+	ChunkSize    int64  `gorm:"not null"`           // 登记时确定的分片大小，最后一片可以更小
+	Received     int64  `gorm:"not null;default:0"` // 已接收的字节数
+	Parts        int    `gorm:"not null;default:0"` // 已写入的分片数
+	Plaintext    bool   // 明文上传，合并完成时服务端嗅探 MIME 类型并校验尺寸
+	Width        int    // 图片或视频的宽高，明文图片与 MP4、QuickTime 视频为校验后的实际值
+	Height       int
+	ThumbnailID  string `gorm:"type:varchar(64)"` // 随附件一同登记的缩略图附件 ID
+	CompletedAt  *time.Time
+}
+
+// OfflineMessage 接收者离线时暂存的消息，客户端确认后删除
+type OfflineMessage struct {
+	gorm.Model
+	RecipientUUID string `gorm:"type:varchar(64);not null;index:idx_offline_recipient_device"`
+	DeviceID      int    `gorm:"not null;default:1;index:idx_offline_recipient_device"`
+	RoomUUID      string `gorm:"type:varchar(64);not null"`
+	MessageID     string `gorm:"type:varchar(64);index"` // 房间消息的服务端 ID，系统通知等为空
+	Envelope      string `gorm:"type:text;not null"`     // 原样保存的密文信封 JSON
+}
+
+// MessageReceipt 记录每条消息对每个接收者的送达与已读状态
+type MessageReceipt struct {
+	gorm.Model
+	MessageID     string     `gorm:"type:varchar(64);not null;uniqueIndex:idx_receipt_message_recipient"`
+	RecipientUUID string     `gorm:"type:varchar(64);not null;uniqueIndex:idx_receipt_message_recipient"`
+	RoomUUID      string     `gorm:"type:varchar(64);not null"`
+	SenderUUID    string     `gorm:"type:varchar(64);not null"`
+	DeliveredAt   *time.Time // 为空表示尚未送达
+	ReadAt        *time.Time // 为空表示尚未已读
+}
+
+// SenderKeyDistribution 记录房间内每个发送者的 Sender Key 已分发给哪些成员的哪些设备及其代数
+type SenderKeyDistribution struct {
+	gorm.Model
+	RoomUUID          string `gorm:"type:varchar(64);not null;uniqueIndex:idx_sender_key_room_sender_recipient_device"`
+	SenderUUID        string `gorm:"type:varchar(64);not null;uniqueIndex:idx_sender_key_room_sender_recipient_device"`
+	RecipientUUID     string `gorm:"type:varchar(64);not null;uniqueIndex:idx_sender_key_room_sender_recipient_device"`
+	RecipientDeviceID int    `gorm:"not null;default:1;uniqueIndex:idx_sender_key_room_sender_recipient_device"`
+	DistributionID    string `gorm:"type:varchar(64);not null"`
+	Generation        int    `gorm:"not null"`
 }
 
 type SignalIdentityKey struct {
 	gorm.Model
-	ChatUserUUID   string `gorm:"type:varchar(64);not null;uniqueIndex"`
+	ChatUserUUID   string `gorm:"type:varchar(64);not null;uniqueIndex:idx_identity_user_device"`
+	DeviceID       int    `gorm:"not null;default:1;uniqueIndex:idx_identity_user_device"`
 	RegistrationID uint32 `gorm:"not null"`
 	IdentityKey    string `gorm:"type:text;not null"` // Base64 编码
 }
 
+// SignalIdentityKeyHistory 被替换掉的历史身份密钥
+type SignalIdentityKeyHistory struct {
+	gorm.Model
+	ChatUserUUID   string    `gorm:"type:varchar(64);not null;index"`
+	DeviceID       int       `gorm:"not null"`
+	RegistrationID uint32    `gorm:"not null"`
+	IdentityKey    string    `gorm:"type:text;not null"` // Base64 编码
+	ReplacedAt     time.Time `gorm:"not null"`
+}
+
+// SignalSignedPreKey 签名预密钥，同一设备可能同时存在处于宽限期内的多条有效记录，最新的一条为当前密钥
 type SignalSignedPreKey struct {
 	gorm.Model
 	ChatUserUUID        string `gorm:"type:varchar(64);not null;index"`
+	DeviceID            int    `gorm:"not null;default:1"`
 	PreKeyID            uint32 `gorm:"not null"`
 	PreKeyPublic        string `gorm:"type:text;not null"`
 	PreKeySignature     string `gorm:"type:text;not null"`
-	ValidUntilTimestamp int64  `gorm:"not null"`     // 可选：用于前端判断是否需要刷新
-	IsActive            bool   `gorm:"default:true"` // 用于轮换时标记是否为当前生效的
+	ValidUntilTimestamp int64  `gorm:"not null"`               // 有效期截止的 Unix 时间戳（秒）
+	IsActive            bool   `gorm:"default:true"`           // 用于轮换时标记是否为当前生效的
+	ExpiryNotified      bool   `gorm:"not null;default:false"` // 是否已推送过即将到期提醒
 }
 
+// SignalPreKey 一次性预密钥，取用时直接删除
 type SignalPreKey struct {
 	gorm.Model
 	ChatUserUUID string `gorm:"type:varchar(64);not null;index"`
+	DeviceID     int    `gorm:"not null;default:1"`
 	PreKeyID     uint32 `gorm:"not null;index"`
 	PreKeyPublic string `gorm:"type:text;not null"`
-	IsUsed       bool   `gorm:"default:false"` // 是否已被取用
+	IsLastResort bool   `gorm:"not null;default:false"` // 兜底密钥，池为空时返回且不会被删除
 }
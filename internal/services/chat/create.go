@@ -1,13 +1,20 @@
 package chat
 
 import (
+	"errors"
+
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"qianmianyao/MistChat-Server/internal/models/entity"
+	"qianmianyao/MistChat-Server/pkg/encryption"
 	"qianmianyao/MistChat-Server/pkg/global"
 	"time"
 )
 
+// ErrQuotaExceeded 登记附件后用户的附件总量将超出配额
+var ErrQuotaExceeded = errors.New("attachment quota exceeded")
+
 type Create struct {
 	db *gorm.DB
 }
@@ -31,8 +38,41 @@ func (c *Create) User(username, uuid string) error {
 	return nil
 }
 
-// Room create room
+// Device 为用户登记一台新设备，设备号在该用户已有设备的基础上递增
+func (c *Create) Device(uuid, name string) (entity.Device, error) {
+	device := entity.Device{ChatUserUUID: uuid, Name: name}
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		// 锁定用户记录，串行化同一用户的并发登记；用户还没有设备时无设备行可锁，因此锁用户行
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("uuid = ?", uuid).First(&entity.ChatUser{}).Error; err != nil {
+			return err
+		}
+		// 唯一索引包含已软删除的设备，设备号需在其基础上递增
+		var maxDeviceID int
+		if err := tx.Unscoped().Model(&entity.Device{}).Where("chat_user_uuid = ?", uuid).
+			Select("COALESCE(MAX(device_id), 0)").Scan(&maxDeviceID).Error; err != nil {
+			return err
+		}
+		device.DeviceID = maxDeviceID + 1
+		return tx.Create(&device).Error
+	})
+	if err != nil {
+		global.Logger.Error("登记设备失败: ", zap.Error(err))
+		return device, err
+	}
+	return device, nil
+}
+
+// Room create room，密码不为空时以 Argon2id 哈希保存
 func (c *Create) Room(roomName, roomUUID, password string, isprivate bool) error {
+	if password != "" {
+		hash, err := encryption.HashPassword(password)
+		if err != nil {
+			global.Logger.Error("计算房间密码哈希失败: ", zap.Error(err))
+			return err
+		}
+		password = hash
+	}
 	room := entity.Room{
 		UUID:      roomUUID,
 		Name:      roomName,
@@ -46,12 +86,13 @@ func (c *Create) Room(roomName, roomUUID, password string, isprivate bool) error
 	return nil
 }
 
-// RoomMembers join room members
-func (c *Create) RoomMembers(uuid, roomUUID string) error {
+// RoomMembers join room members，role 为成员在房间内的角色
+func (c *Create) RoomMembers(uuid, roomUUID, role string) error {
 	roomMembers := entity.RoomMembers{
 		ChatUserUUID: uuid,
 		RoomUUID:     roomUUID,
 		JoinTime:     time.Now(),
+		Role:         role,
 	}
 	if err := c.db.Create(&roomMembers).Error; err != nil {
 		global.Logger.Error("加入房间失败: ", zap.Error(err))
@@ -60,6 +101,70 @@ func (c *Create) RoomMembers(uuid, roomUUID string) error {
 	return nil
 }
 
+// RoomMessage 保存房间消息历史
+func (c *Create) RoomMessage(roomMessage *entity.RoomMessage) error {
+	if err := c.db.Create(roomMessage).Error; err != nil {
+		global.Logger.Error("保存房间消息失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// OfflineMessage 为离线接收者的指定设备暂存消息
+func (c *Create) OfflineMessage(recipientUUID string, deviceID int, roomUUID, messageID string, envelope []byte) error {
+	offlineMessage := entity.OfflineMessage{
+		RecipientUUID: recipientUUID,
+		DeviceID:      deviceID,
+		RoomUUID:      roomUUID,
+		MessageID:     messageID,
+		Envelope:      string(envelope),
+	}
+	if err := c.db.Create(&offlineMessage).Error; err != nil {
+		global.Logger.Error("暂存离线消息失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// MessageReceipts 为消息的每个接收者创建回执记录，重复的接收者只记录一次
+func (c *Create) MessageReceipts(messageID, roomUUID, senderUUID string, recipients []string) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+	receipts := make([]entity.MessageReceipt, 0, len(recipients))
+	seen := make(map[string]bool, len(recipients))
+	for _, recipient := range recipients {
+		if seen[recipient] {
+			continue
+		}
+		seen[recipient] = true
+		receipts = append(receipts, entity.MessageReceipt{
+			MessageID:     messageID,
+			RecipientUUID: recipient,
+			RoomUUID:      roomUUID,
+			SenderUUID:    senderUUID,
+		})
+	}
+	if err := c.db.Create(&receipts).Error; err != nil {
+		global.Logger.Error("创建消息回执失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// SenderKeyDistribution 记录发送者的 Sender Key 已分发给某成员的某台设备，同一设备只保留最新一次
+func (c *Create) SenderKeyDistribution(distribution entity.SenderKeyDistribution) error {
+	err := c.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "room_uuid"}, {Name: "sender_uuid"}, {Name: "recipient_uuid"}, {Name: "recipient_device_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"distribution_id", "generation", "updated_at", "deleted_at"}),
+	}).Create(&distribution).Error
+	if err != nil {
+		global.Logger.Error("记录 Sender Key 分发失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
 // SignalIdentityKey 身份密钥
 func (c *Create) SignalIdentityKey(signalIdentityKey entity.SignalIdentityKey) error {
 	if err := c.db.Create(&signalIdentityKey).Error; err != nil {
@@ -69,9 +174,19 @@ func (c *Create) SignalIdentityKey(signalIdentityKey entity.SignalIdentityKey) e
 	return nil
 }
 
-// SignalSignedPreKey 预签名密钥
-func (c *Create) SignalSignedPreKey(signalSignedPreKey entity.SignalSignedPreKey) error {
-	if err := c.db.Create(&signalSignedPreKey).Error; err != nil {
+// SignalSignedPreKey 预签名密钥。
+// 新密钥成为设备的当前密钥，同设备仍有效的旧密钥有效期缩短到 graceUntil，由后台任务到期后停用。
+func (c *Create) SignalSignedPreKey(signalSignedPreKey entity.SignalSignedPreKey, graceUntil int64) error {
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.SignalSignedPreKey{}).
+			Where("chat_user_uuid = ? AND device_id = ? AND is_active = ?", signalSignedPreKey.ChatUserUUID, signalSignedPreKey.DeviceID, true).
+			Where("valid_until_timestamp = 0 OR valid_until_timestamp > ?", graceUntil).
+			Update("valid_until_timestamp", graceUntil).Error; err != nil {
+			return err
+		}
+		return tx.Create(&signalSignedPreKey).Error
+	})
+	if err != nil {
 		global.Logger.Error("创建 SignalSignedPreKey 失败: ", zap.Error(err))
 		return err
 	}
@@ -86,3 +201,85 @@ func (c *Create) SignalPreKey(signalPreKey entity.SignalPreKey) error {
 	}
 	return nil
 }
+
+// SignalPreKeys 批量创建一次性密钥
+func (c *Create) SignalPreKeys(signalPreKeys []entity.SignalPreKey) error {
+	if err := c.db.Create(&signalPreKeys).Error; err != nil {
+		global.Logger.Error("批量创建 SignalPreKey 失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// SignalLastResortPreKey 替换设备的兜底密钥
+func (c *Create) SignalLastResortPreKey(signalPreKey entity.SignalPreKey) error {
+	signalPreKey.IsLastResort = true
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().
+			Where("chat_user_uuid = ? AND device_id = ? AND is_last_resort = ?", signalPreKey.ChatUserUUID, signalPreKey.DeviceID, true).
+			Delete(&entity.SignalPreKey{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&signalPreKey).Error
+	})
+	if err != nil {
+		global.Logger.Error("替换兜底 SignalPreKey 失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// RoomInvite 保存房间邀请码
+func (c *Create) RoomInvite(invite *entity.RoomInvite) error {
+	if err := c.db.Create(invite).Error; err != nil {
+		global.Logger.Error("创建房间邀请失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// MessageReaction 记录用户对消息的表情回应，重复回应同一表情时忽略，added 表示是否新增了记录
+func (c *Create) MessageReaction(messageID, roomUUID, uuid, emoji string) (added bool, err error) {
+	reaction := entity.MessageReaction{
+		MessageID:    messageID,
+		ChatUserUUID: uuid,
+		Emoji:        emoji,
+		RoomUUID:     roomUUID,
+	}
+	result := c.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&reaction)
+	if result.Error != nil {
+		global.Logger.Error("记录表情回应失败: ", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Attachment 在同一条语句中登记 ownerUUID 的附件及其缩略图的分片上传。
+// 锁定用户记录后统计其所有附件（包括尚未上传完成的）声明的总字节数，并发登记不会突破 quota；超出时返回 ErrQuotaExceeded
+func (c *Create) Attachment(ownerUUID string, quota int64, attachments ...*entity.Attachment) error {
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("uuid = ?", ownerUUID).First(&entity.ChatUser{}).Error; err != nil {
+			return err
+		}
+		var usage int64
+		if err := tx.Model(&entity.Attachment{}).Where("owner_uuid = ?", ownerUUID).
+			Select("COALESCE(SUM(size), 0)").Scan(&usage).Error; err != nil {
+			return err
+		}
+		for _, attachment := range attachments {
+			usage += attachment.Size
+		}
+		if usage > quota {
+			return ErrQuotaExceeded
+		}
+		return tx.Create(attachments).Error
+	})
+	if err != nil {
+		if !errors.Is(err, ErrQuotaExceeded) {
+			global.Logger.Error("登记附件上传失败: ", zap.Error(err))
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"qianmianyao/MistChat-Server/internal/models/entity"
+	"qianmianyao/MistChat-Server/pkg/global"
+)
+
+type Delete struct {
+	db *gorm.DB
+}
+
+func NewDelete() *Delete {
+	return &Delete{
+		db: global.DB,
+	}
+}
+
+// OfflineMessages 删除设备已确认的离线消息
+func (d *Delete) OfflineMessages(uuid string, deviceID int, ids []uint) error {
+	err := d.db.Unscoped().Where("recipient_uuid = ? AND device_id = ? AND id IN ?", uuid, deviceID, ids).
+		Delete(&entity.OfflineMessage{}).Error
+	if err != nil {
+		global.Logger.Error("删除离线消息失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// ClaimSignalPreKey 原子地取出并删除设备的一条一次性密钥。
+// 使用 FOR UPDATE SKIP LOCKED 的子查询配合 DELETE ... RETURNING，并发请求不会拿到同一条密钥；
+// 池为空时返回不会被删除的兜底密钥，两者都没有时返回 gorm.ErrRecordNotFound。
+func (d *Delete) ClaimSignalPreKey(uuid string, deviceID int) (entity.SignalPreKey, error) {
+	var signalPreKey entity.SignalPreKey
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		candidate := tx.Model(&entity.SignalPreKey{}).Select("id").
+			Where("chat_user_uuid = ? AND device_id = ? AND is_last_resort = ?", uuid, deviceID, false).
+			Order("id ASC").
+			Limit(1).
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+
+		result := tx.Unscoped().Clauses(clause.Returning{}).Where("id = (?)", candidate).Delete(&signalPreKey)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return nil
+		}
+
+		return tx.Where("chat_user_uuid = ? AND device_id = ? AND is_last_resort = ?", uuid, deviceID, true).
+			First(&signalPreKey).Error
+	})
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			global.Logger.Error("取用 SignalPreKey 失败: ", zap.Error(err))
+		}
+		return signalPreKey, err
+	}
+	return signalPreKey, nil
+}
+
+// SenderKeyDistributions 清除房间内所有 Sender Key 分发记录，成员变动后需要重新分发
+func (d *Delete) SenderKeyDistributions(roomUUID string) error {
+	err := d.db.Unscoped().Where("room_uuid = ?", roomUUID).Delete(&entity.SenderKeyDistribution{}).Error
+	if err != nil {
+		global.Logger.Error("清除 Sender Key 分发记录失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// RoomInvite 撤销房间的邀请码，邀请不存在时返回 gorm.ErrRecordNotFound
+func (d *Delete) RoomInvite(roomUUID, code string) error {
+	result := d.db.Where("room_uuid = ? AND code = ?", roomUUID, code).Delete(&entity.RoomInvite{})
+	if result.Error != nil {
+		global.Logger.Error("撤销房间邀请失败: ", zap.Error(result.Error))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// LeaveResult 成员离开房间后的结果
+type LeaveResult struct {
+	NewOwner      string   // 房主离开时接任的成员，未发生转让时为空
+	RoomDeleted   bool     // 最后一名成员离开后房间随之删除
+	AttachmentIDs []string // 房间删除时一并删除记录的附件，调用方需清理其存储内容
+}
+
+// RoomMember 使成员离开房间并清除其尚未投递的该房间离线消息。
+// 房主离开时，房主身份转让给加入最早的管理员，没有管理员时转让给加入最早的成员；最后一名成员离开后删除房间。
+func (d *Delete) RoomMember(uuid, roomUUID string) (LeaveResult, error) {
+	var result LeaveResult
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		var member entity.RoomMembers
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("chat_user_uuid = ? AND room_uuid = ?", uuid, roomUUID).First(&member).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("chat_user_uuid = ? AND room_uuid = ?", uuid, roomUUID).Delete(&entity.RoomMembers{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("recipient_uuid = ? AND room_uuid = ?", uuid, roomUUID).
+			Delete(&entity.OfflineMessage{}).Error; err != nil {
+			return err
+		}
+		if member.Role != entity.RoomRoleOwner {
+			return nil
+		}
+
+		var successor entity.RoomMembers
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("room_uuid = ?", roomUUID).
+			Order("CASE WHEN role = '" + entity.RoomRoleAdmin + "' THEN 0 ELSE 1 END, join_time ASC").
+			First(&successor).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			result.RoomDeleted = true
+			result.AttachmentIDs, err = deleteRoom(tx, roomUUID)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		result.NewOwner = successor.ChatUserUUID
+		return tx.Model(&successor).Update("role", entity.RoomRoleOwner).Error
+	})
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			global.Logger.Error("离开房间失败: ", zap.Error(err))
+		}
+		return result, err
+	}
+	return result, nil
+}
+
+// Room 删除房间及其成员、邀请、离线消息、附件与 Sender Key 分发记录。房间与成员为软删除，保留历史记录；
+// 返回被删除记录的附件 ID，调用方需清理其存储内容
+func (d *Delete) Room(roomUUID string) ([]string, error) {
+	var attachmentIDs []string
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		attachmentIDs, err = deleteRoom(tx, roomUUID)
+		return err
+	})
+	if err != nil {
+		global.Logger.Error("删除房间失败: ", zap.Error(err))
+		return nil, err
+	}
+	return attachmentIDs, nil
+}
+
+func deleteRoom(tx *gorm.DB, roomUUID string) ([]string, error) {
+	if err := tx.Where("room_uuid = ?", roomUUID).Delete(&entity.RoomMembers{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("room_uuid = ?", roomUUID).Delete(&entity.RoomInvite{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Where("room_uuid = ?", roomUUID).Delete(&entity.OfflineMessage{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("room_uuid = ?", roomUUID).Delete(&entity.RoomMessage{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Where("room_uuid = ?", roomUUID).Delete(&entity.MessageReaction{}).Error; err != nil {
+		return nil, err
+	}
+	var attachmentIDs []string
+	if err := tx.Unscoped().Model(&entity.Attachment{}).Where("room_uuid = ?", roomUUID).
+		Pluck("attachment_id", &attachmentIDs).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Where("room_uuid = ?", roomUUID).Delete(&entity.Attachment{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Where("room_uuid = ?", roomUUID).Delete(&entity.SenderKeyDistribution{}).Error; err != nil {
+		return nil, err
+	}
+	return attachmentIDs, tx.Where("uuid = ?", roomUUID).Delete(&entity.Room{}).Error
+}
+
+// envelopeAttachment 从密文信封中读取消息引用的附件 ID，附件引用不在加密负载内
+type envelopeAttachment struct {
+	Message struct {
+		Content struct {
+			Attachment *struct {
+				Id string `json:"id"`
+			} `json:"attachment"`
+		} `json:"content"`
+	} `json:"message"`
+}
+
+// RoomMessage 为所有人撤回消息：从消息历史中彻底删除（不保留密文），并移除尚未投递的离线副本。
+// 消息引用的附件不再被房间内其他消息引用时，附件及其缩略图的记录一并删除，返回其 ID 供调用方清理存储内容
+func (d *Delete) RoomMessage(messageID string) ([]string, error) {
+	var attachmentIDs []string
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		var message entity.RoomMessage
+		if err := tx.Unscoped().Clauses(clause.Returning{}).Where("message_id = ?", messageID).
+			Delete(&message).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("message_id = ?", messageID).Delete(&entity.MessageReaction{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("message_id = ?", messageID).Delete(&entity.OfflineMessage{}).Error; err != nil {
+			return err
+		}
+
+		var ref envelopeAttachment
+		if err := json.Unmarshal([]byte(message.Envelope), &ref); err != nil || ref.Message.Content.Attachment == nil {
+			return nil
+		}
+		attachmentID := ref.Message.Content.Attachment.Id
+		var references int64
+		if err := tx.Model(&entity.RoomMessage{}).
+			Where("room_uuid = ? AND envelope::jsonb #>> '{message,content,attachment,id}' = ?", message.RoomUUID, attachmentID).
+			Count(&references).Error; err != nil {
+			return err
+		}
+		if references > 0 {
+			return nil
+		}
+		var attachment entity.Attachment
+		if err := tx.Where("attachment_id = ? AND room_uuid = ?", attachmentID, message.RoomUUID).
+			First(&attachment).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		attachmentIDs = append(attachmentIDs, attachment.AttachmentID)
+		if attachment.ThumbnailID != "" {
+			attachmentIDs = append(attachmentIDs, attachment.ThumbnailID)
+		}
+		return tx.Unscoped().Where("attachment_id IN ?", attachmentIDs).Delete(&entity.Attachment{}).Error
+	})
+	if err != nil {
+		global.Logger.Error("撤回房间消息失败: ", zap.Error(err))
+		return nil, err
+	}
+	return attachmentIDs, nil
+}
+
+// MessageReaction 取消用户对消息的某个表情回应，removed 表示是否确实删除了记录
+func (d *Delete) MessageReaction(messageID, uuid, emoji string) (removed bool, err error) {
+	result := d.db.Unscoped().Where("message_id = ? AND chat_user_uuid = ? AND emoji = ?", messageID, uuid, emoji).
+		Delete(&entity.MessageReaction{})
+	if result.Error != nil {
+		global.Logger.Error("取消表情回应失败: ", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ExpiredAttachmentUploads 删除 before 之前登记且仍未完成的附件上传及其缩略图的记录，返回被删除的附件 ID
+func (d *Delete) ExpiredAttachmentUploads(before time.Time) ([]string, error) {
+	var expired []entity.Attachment
+	thumbnails := d.db.Model(&entity.Attachment{}).Select("thumbnail_id").
+		Where("completed_at IS NULL AND created_at < ? AND thumbnail_id <> ''", before)
+	err := d.db.Unscoped().Clauses(clause.Returning{}).
+		Where("(completed_at IS NULL AND created_at < ?) OR attachment_id IN (?)", before, thumbnails).
+		Delete(&expired).Error
+	if err != nil {
+		global.Logger.Error("清理过期附件上传失败: ", zap.Error(err))
+		return nil, err
+	}
+	attachmentIDs := make([]string, 0, len(expired))
+	for _, attachment := range expired {
+		attachmentIDs = append(attachmentIDs, attachment.AttachmentID)
+	}
+	return attachmentIDs, nil
+}
+
+// Attachment 删除附件记录，释放其占用的配额
+func (d *Delete) Attachment(attachmentIDs ...string) error {
+	if err := d.db.Unscoped().Where("attachment_id IN ?", attachmentIDs).Delete(&entity.Attachment{}).Error; err != nil {
+		global.Logger.Error("删除附件失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -1,8 +1,12 @@
 package chat
 
 import (
+	"time"
+
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 	"qianmianyao/MistChat-Server/internal/models/entity"
+	"qianmianyao/MistChat-Server/pkg/encryption"
 	"qianmianyao/MistChat-Server/pkg/global"
 )
 
@@ -65,6 +69,34 @@ func (f *Find) IsTheUserIsInTheRoom(uuid, roomUUID string) RoomStatus {
 	return NotInRoom
 }
 
+// Room 根据UUID获取未删除的房间
+func (f *Find) Room(roomUUID string) (entity.Room, error) {
+	var room entity.Room
+	err := f.db.Where("uuid = ?", roomUUID).First(&room).Error
+	return room, err
+}
+
+// IsRoomArchived 检查房间是否已归档
+func (f *Find) IsRoomArchived(roomUUID string) bool {
+	var count int64
+	f.db.Model(&entity.Room{}).Where("uuid = ? AND archived_at IS NOT NULL", roomUUID).Count(&count)
+	return count > 0
+}
+
+// MemberRole 获取用户在房间内的角色，不在房间内时返回 gorm.ErrRecordNotFound
+func (f *Find) MemberRole(uuid, roomUUID string) (string, error) {
+	var member entity.RoomMembers
+	err := f.db.Where("chat_user_uuid = ? AND room_uuid = ?", uuid, roomUUID).First(&member).Error
+	return member.Role, err
+}
+
+// IsBanned 检查用户是否被房间封禁
+func (f *Find) IsBanned(uuid, roomUUID string) bool {
+	var count int64
+	f.db.Model(&entity.RoomBan{}).Where("chat_user_uuid = ? AND room_uuid = ?", uuid, roomUUID).Count(&count)
+	return count > 0
+}
+
 // IsRequirePassword 检查房间是否需要密码
 func (f *Find) IsRequirePassword(uuid string) PasswordType {
 	var room entity.Room
@@ -82,22 +114,47 @@ func (f *Find) AllUsersInTheRoom(roomUUID string) []string {
 	var roomMembers []entity.RoomMembers
 	f.db.Model(&entity.RoomMembers{}).Where("room_uuid = ?", roomUUID).Find(&roomMembers)
 	var usersUUID []string
+	seen := make(map[string]bool, len(roomMembers))
 	for _, roomMember := range roomMembers {
+		if seen[roomMember.ChatUserUUID] {
+			continue
+		}
+		seen[roomMember.ChatUserUUID] = true
 		usersUUID = append(usersUUID, roomMember.ChatUserUUID)
 	}
 	return usersUUID
 }
 
-// VerifyPassword 验证房间密码
-func (f *Find) VerifyPassword(roomUUID, password string) VerificationResults {
+// RoomPeers 获取与用户至少共享一个房间的其他用户
+func (f *Find) RoomPeers(uuid string) ([]string, error) {
+	var peers []string
+	myRooms := f.db.Model(&entity.RoomMembers{}).Select("room_uuid").Where("chat_user_uuid = ?", uuid)
+	err := f.db.Model(&entity.RoomMembers{}).
+		Distinct("chat_user_uuid").
+		Where("room_uuid IN (?) AND chat_user_uuid <> ?", myRooms, uuid).
+		Pluck("chat_user_uuid", &peers).Error
+	if err != nil {
+		global.Logger.Error("获取同房间用户失败")
+		return peers, err
+	}
+	return peers, nil
+}
+
+// VerifyPassword 验证房间密码。
+// 房间密码以 Argon2id 哈希保存，校验在 Go 中以常量时间完成；needsRehash 表示库中仍是历史明文或旧参数哈希，需要调用方重新保存。
+func (f *Find) VerifyPassword(roomUUID, password string) (result VerificationResults, needsRehash bool) {
 	var room entity.Room
-	if err := f.db.Where("uuid = ? AND password = ?", roomUUID, password).First(&room).Error; err != nil {
-		return PasswordIncorrect
+	if err := f.db.Where("uuid = ?", roomUUID).First(&room).Error; err != nil {
+		return PasswordIncorrect, false
+	}
+	if room.Password == "" {
+		return PasswordCorrect, false
 	}
-	if room.Password == password {
-		return PasswordCorrect
+	ok, needsRehash := encryption.VerifyPassword(room.Password, password)
+	if !ok {
+		return PasswordIncorrect, false
 	}
-	return PasswordIncorrect
+	return PasswordCorrect, needsRehash
 }
 
 // ChatUserUUIDByID 根据用户ID获取用户UUID
@@ -109,39 +166,113 @@ func (f *Find) ChatUserUUIDByID(id uint) string {
 	return user.UUID
 }
 
+// ChatUserByUUID 根据用户UUID获取用户
+func (f *Find) ChatUserByUUID(uuid string) (entity.ChatUser, error) {
+	var user entity.ChatUser
+	err := f.db.Where("uuid = ?", uuid).First(&user).Error
+	return user, err
+}
+
+// ChatUsersByUUIDs 批量获取用户
+func (f *Find) ChatUsersByUUIDs(uuids []string) ([]entity.ChatUser, error) {
+	var users []entity.ChatUser
+	err := f.db.Where("uuid IN ?", uuids).Find(&users).Error
+	if err != nil {
+		global.Logger.Error("批量获取用户失败: ", zap.Error(err))
+		return users, err
+	}
+	return users, nil
+}
+
+// IsDeviceExist 检查设备是否属于该用户
+func (f *Find) IsDeviceExist(uuid string, deviceID int) bool {
+	var count int64
+	f.db.Model(&entity.Device{}).Where("chat_user_uuid = ? AND device_id = ?", uuid, deviceID).Count(&count)
+	return count > 0
+}
+
+// Devices 获取用户的所有设备
+func (f *Find) Devices(uuid string) ([]entity.Device, error) {
+	var devices []entity.Device
+	if err := f.db.Where("chat_user_uuid = ?", uuid).Order("device_id ASC").Find(&devices).Error; err != nil {
+		global.Logger.Error("获取用户设备失败")
+		return devices, err
+	}
+	return devices, nil
+}
+
+// DeviceIDsOfUsers 批量获取多个用户的设备号
+func (f *Find) DeviceIDsOfUsers(uuids []string) (map[string][]int, error) {
+	var devices []entity.Device
+	deviceIDs := make(map[string][]int, len(uuids))
+	if len(uuids) == 0 {
+		return deviceIDs, nil
+	}
+	if err := f.db.Where("chat_user_uuid IN ?", uuids).Find(&devices).Error; err != nil {
+		global.Logger.Error("批量获取用户设备失败")
+		return deviceIDs, err
+	}
+	for _, device := range devices {
+		deviceIDs[device.ChatUserUUID] = append(deviceIDs[device.ChatUserUUID], device.DeviceID)
+	}
+	return deviceIDs, nil
+}
+
 // SignalIdentityKey 获取 SignalIdentityKey
-func (f *Find) SignalIdentityKey(uuid string) entity.SignalIdentityKey {
+func (f *Find) SignalIdentityKey(uuid string, deviceID int) entity.SignalIdentityKey {
 	var signalIdentityKey entity.SignalIdentityKey
-	if err := f.db.Where("chat_user_uuid = ?", uuid).First(&signalIdentityKey).Error; err != nil {
+	if err := f.db.Where("chat_user_uuid = ? AND device_id = ?", uuid, deviceID).First(&signalIdentityKey).Error; err != nil {
 		return signalIdentityKey
 	}
 	return signalIdentityKey
 }
 
-// SignalSignedPreKey 获取 SignalSignedPreKey
-func (f *Find) SignalSignedPreKey(uuid string) entity.SignalSignedPreKey {
+// SignalSignedPreKey 获取设备最新的有效 SignalSignedPreKey
+func (f *Find) SignalSignedPreKey(uuid string, deviceID int) entity.SignalSignedPreKey {
 	var signalSignedPreKey entity.SignalSignedPreKey
-	if err := f.db.Where("chat_user_uuid = ?", uuid).First(&signalSignedPreKey).Error; err != nil {
+	if err := f.db.Where("chat_user_uuid = ? AND device_id = ? AND is_active = ?", uuid, deviceID, true).
+		Order("created_at DESC, id DESC").
+		First(&signalSignedPreKey).Error; err != nil {
 		return signalSignedPreKey
 	}
 	return signalSignedPreKey
 }
 
-// SignalPreKey 获取 SignalPreKey
-func (f *Find) SignalPreKey(uuid string) (entity.SignalPreKey, error) {
-	var signalPreKey entity.SignalPreKey
-	err := f.db.Where("chat_user_uuid = ? AND is_used = ?", uuid, false).First(&signalPreKey).Error
+// ExpiringSignalSignedPreKeys 获取各设备当前签名预密钥中将在 before 之前到期且尚未提醒过的记录
+func (f *Find) ExpiringSignalSignedPreKeys(before int64) ([]entity.SignalSignedPreKey, error) {
+	var current []entity.SignalSignedPreKey
+	latest := f.db.Model(&entity.SignalSignedPreKey{}).
+		Select("DISTINCT ON (chat_user_uuid, device_id) *").
+		Where("is_active = ?", true).
+		Order("chat_user_uuid, device_id, created_at DESC, id DESC")
+	err := f.db.Unscoped().Table("(?) AS latest", latest).
+		Where("valid_until_timestamp < ? AND expiry_notified = ?", before, false).
+		Find(&current).Error
+	if err != nil {
+		global.Logger.Error("获取即将到期的 SignalSignedPreKey 失败")
+		return current, err
+	}
+	return current, nil
+}
+
+// UnusedSignalPreKeyCount 获取设备剩余未使用的一次性密钥数量，不含兜底密钥
+func (f *Find) UnusedSignalPreKeyCount(uuid string, deviceID int) (int64, error) {
+	var count int64
+	err := f.db.Model(&entity.SignalPreKey{}).
+		Where("chat_user_uuid = ? AND device_id = ? AND is_last_resort = ?", uuid, deviceID, false).
+		Count(&count).Error
 	if err != nil {
-		return signalPreKey, err
+		global.Logger.Error("统计剩余 SignalPreKey 失败")
+		return count, err
 	}
-	return signalPreKey, nil
+	return count, nil
 }
 
 // UsersRooms 获取用户所有的房间
 func (f *Find) UsersRooms(uuid string) ([]entity.Room, error) {
 	var rooms []entity.Room
 	err := f.db.Model(&entity.Room{}).Joins("JOIN room_members ON rooms.uuid = room_members.room_uuid").
-		Where("room_members.chat_user_uuid = ?", uuid).
+		Where("room_members.chat_user_uuid = ? AND room_members.deleted_at IS NULL", uuid).
 		Find(&rooms).Error
 	if err != nil {
 		global.Logger.Error("获取用户房间失败")
@@ -149,3 +280,189 @@ func (f *Find) UsersRooms(uuid string) ([]entity.Room, error) {
 	}
 	return rooms, nil
 }
+
+// OfflineMessages 按写入顺序获取设备 afterID 之后的离线消息
+func (f *Find) OfflineMessages(uuid string, deviceID int, afterID uint, limit int) ([]entity.OfflineMessage, error) {
+	var offlineMessages []entity.OfflineMessage
+	err := f.db.Where("recipient_uuid = ? AND device_id = ? AND id > ?", uuid, deviceID, afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&offlineMessages).Error
+	if err != nil {
+		global.Logger.Error("获取离线消息失败")
+		return offlineMessages, err
+	}
+	return offlineMessages, nil
+}
+
+// MessageReceipts 获取一条消息的所有回执
+func (f *Find) MessageReceipts(messageID string) ([]entity.MessageReceipt, error) {
+	var receipts []entity.MessageReceipt
+	if err := f.db.Where("message_id = ?", messageID).Find(&receipts).Error; err != nil {
+		global.Logger.Error("获取消息回执失败")
+		return receipts, err
+	}
+	return receipts, nil
+}
+
+// SenderKeyHolders 获取已收到发送者指定 Sender Key 分发 ID 与代数的成员设备：uuid -> 设备号 -> true
+func (f *Find) SenderKeyHolders(roomUUID, senderUUID, distributionID string, generation int) (map[string]map[int]bool, error) {
+	var distributions []entity.SenderKeyDistribution
+	holders := make(map[string]map[int]bool)
+	err := f.db.Where("room_uuid = ? AND sender_uuid = ? AND distribution_id = ? AND generation = ?", roomUUID, senderUUID, distributionID, generation).
+		Find(&distributions).Error
+	if err != nil {
+		global.Logger.Error("获取 Sender Key 分发记录失败")
+		return holders, err
+	}
+	for _, distribution := range distributions {
+		if holders[distribution.RecipientUUID] == nil {
+			holders[distribution.RecipientUUID] = make(map[int]bool)
+		}
+		holders[distribution.RecipientUUID][distribution.RecipientDeviceID] = true
+	}
+	return holders, nil
+}
+
+// RoomInvites 获取房间内仍然有效（未撤销、未过期、未用尽）的邀请码
+func (f *Find) RoomInvites(roomUUID string) ([]entity.RoomInvite, error) {
+	var invites []entity.RoomInvite
+	err := f.db.Where("room_uuid = ? AND (expires_at IS NULL OR expires_at > ?) AND (max_uses = 0 OR uses < max_uses)",
+		roomUUID, time.Now()).
+		Order("id DESC").
+		Find(&invites).Error
+	if err != nil {
+		global.Logger.Error("获取房间邀请失败: ", zap.Error(err))
+		return invites, err
+	}
+	return invites, nil
+}
+
+// RoomInvite 根据邀请码获取未撤销的邀请
+func (f *Find) RoomInvite(code string) (entity.RoomInvite, error) {
+	var invite entity.RoomInvite
+	err := f.db.Where("code = ?", code).First(&invite).Error
+	return invite, err
+}
+
+// RoomMember 房间成员及其用户信息
+type RoomMember struct {
+	UUID         string
+	Username     string
+	Role         string
+	JoinTime     time.Time
+	HidePresence bool
+}
+
+// RoomMembers 按加入时间分页获取房间成员，同时返回成员总数
+func (f *Find) RoomMembers(roomUUID string, offset, limit int) ([]RoomMember, int64, error) {
+	var members []RoomMember
+	var total int64
+	query := f.db.Model(&entity.RoomMembers{}).Where("room_members.room_uuid = ?", roomUUID).Session(&gorm.Session{})
+	if err := query.Count(&total).Error; err != nil {
+		global.Logger.Error("获取房间成员数量失败: ", zap.Error(err))
+		return members, 0, err
+	}
+	err := query.Select("chat_users.uuid, chat_users.username, chat_users.hide_presence, room_members.role, room_members.join_time").
+		Joins("JOIN chat_users ON chat_users.uuid = room_members.chat_user_uuid AND chat_users.deleted_at IS NULL").
+		Order("room_members.join_time ASC, room_members.id ASC").
+		Offset(offset).
+		Limit(limit).
+		Scan(&members).Error
+	if err != nil {
+		global.Logger.Error("获取房间成员失败: ", zap.Error(err))
+		return members, total, err
+	}
+	return members, total, nil
+}
+
+// RoomMessages 按序号倒序获取房间内 beforeSeq 之前的 limit 条消息，beforeSeq 为 0 时从最新一条开始。
+// threadRoot 不为空时只返回该话题内的回复。
+// hasMore 表示更早的消息是否还有剩余。
+func (f *Find) RoomMessages(roomUUID, threadRoot string, beforeSeq int64, limit int) (messages []entity.RoomMessage, hasMore bool, err error) {
+	query := f.db.Where("room_uuid = ?", roomUUID)
+	if threadRoot != "" {
+		query = query.Where("thread_root = ?", threadRoot)
+	}
+	if beforeSeq > 0 {
+		query = query.Where("seq < ?", beforeSeq)
+	}
+	if err = query.Order("seq DESC").Limit(limit + 1).Find(&messages).Error; err != nil {
+		global.Logger.Error("获取房间消息历史失败: ", zap.Error(err))
+		return nil, false, err
+	}
+	if len(messages) > limit {
+		return messages[:limit], true, nil
+	}
+	return messages, false, nil
+}
+
+// RoomMessage 根据服务端消息 ID 获取未撤回的房间消息
+func (f *Find) RoomMessage(messageID string) (entity.RoomMessage, error) {
+	var message entity.RoomMessage
+	err := f.db.Where("message_id = ?", messageID).First(&message).Error
+	return message, err
+}
+
+// ReactionCount 某条消息上某个表情的回应人数
+type ReactionCount struct {
+	MessageID string
+	Emoji     string
+	Count     int64
+	Reacted   bool // 查询者本人是否回应过该表情
+}
+
+// ReactionCounts 按消息 ID 聚合表情回应人数，并标记 uuid 本人回应过的表情
+func (f *Find) ReactionCounts(messageIDs []string, uuid string) (map[string][]ReactionCount, error) {
+	counts := make(map[string][]ReactionCount)
+	if len(messageIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []ReactionCount
+	err := f.db.Model(&entity.MessageReaction{}).
+		Select("message_id, emoji, COUNT(*) AS count, bool_or(chat_user_uuid = ?) AS reacted", uuid).
+		Where("message_id IN ?", messageIDs).
+		Group("message_id, emoji").
+		Order("message_id, MIN(created_at)").
+		Scan(&rows).Error
+	if err != nil {
+		global.Logger.Error("获取表情回应失败: ", zap.Error(err))
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.MessageID] = append(counts[row.MessageID], row)
+	}
+	return counts, nil
+}
+
+// ThreadUnread 话题根消息 ID 与其中尚未读的回复数
+type ThreadUnread struct {
+	ThreadRoot string
+	Unread     int64
+}
+
+// ThreadUnreadCounts 统计用户在房间内各话题中尚未读的回复数，不返回已全部读完的话题
+func (f *Find) ThreadUnreadCounts(uuid, roomUUID string) ([]ThreadUnread, error) {
+	var counts []ThreadUnread
+	err := f.db.Model(&entity.MessageReceipt{}).
+		Select("room_messages.thread_root, COUNT(*) AS unread").
+		Joins("JOIN room_messages ON room_messages.message_id = message_receipts.message_id AND room_messages.deleted_at IS NULL").
+		Where("message_receipts.recipient_uuid = ? AND message_receipts.room_uuid = ?", uuid, roomUUID).
+		Where("message_receipts.read_at IS NULL AND room_messages.thread_root <> ''").
+		Group("room_messages.thread_root").
+		Order("room_messages.thread_root").
+		Scan(&counts).Error
+	if err != nil {
+		global.Logger.Error("获取话题未读数失败: ", zap.Error(err))
+		return nil, err
+	}
+	return counts, nil
+}
+
+// Attachment 根据附件 ID 获取附件
+func (f *Find) Attachment(attachmentID string) (entity.Attachment, error) {
+	var attachment entity.Attachment
+	err := f.db.Where("attachment_id = ?", attachmentID).First(&attachment).Error
+	return attachment, err
+}
@@ -0,0 +1,162 @@
+package chat
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"qianmianyao/MistChat-Server/internal/models/entity"
+	"qianmianyao/MistChat-Server/pkg/global"
+)
+
+// ModerationAction 房间管理操作
+type ModerationAction string
+
+const (
+	KickMember        ModerationAction = "kick"     // 踢出成员，可再次加入
+	BanMember         ModerationAction = "ban"      // 封禁成员，踢出并禁止再次加入
+	UnbanMember       ModerationAction = "unban"    // 解除封禁
+	PromoteMember     ModerationAction = "promote"  // 将普通成员提升为管理员
+	DemoteMember      ModerationAction = "demote"   // 将管理员降为普通成员
+	TransferOwnership ModerationAction = "transfer" // 转让房主，原房主降为管理员
+)
+
+var (
+	ErrPermissionDenied  = errors.New("permission denied")
+	ErrTargetNotInRoom   = errors.New("target is not a member of the room")
+	ErrInvalidModeration = errors.New("invalid moderation action")
+)
+
+// RemovesMember 判断操作是否会使目标离开房间
+func (a ModerationAction) RemovesMember() bool {
+	return a == KickMember || a == BanMember
+}
+
+// roleRank 返回角色的权限等级，数值越大权限越高
+func roleRank(role string) int {
+	switch role {
+	case entity.RoomRoleOwner:
+		return 3
+	case entity.RoomRoleAdmin:
+		return 2
+	case entity.RoomRoleMember:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// CanManageRoom 判断角色是否具有房间管理权限（管理员及以上）
+func CanManageRoom(role string) bool {
+	return roleRank(role) >= roleRank(entity.RoomRoleAdmin)
+}
+
+type Moderation struct {
+	db *gorm.DB
+}
+
+func NewModeration() *Moderation {
+	return &Moderation{
+		db: global.DB,
+	}
+}
+
+// Apply 校验操作者权限并在事务内执行房间管理操作。
+// 踢出与封禁要求操作者至少为管理员且角色高于目标，目标尚未投递的该房间离线消息随之清除；提升、降级与转让只有房主可以执行。
+// 权限不足返回 ErrPermissionDenied，目标不在房间内返回 ErrTargetNotInRoom，操作与目标角色不符返回 ErrInvalidModeration。
+func (m *Moderation) Apply(roomUUID, operatorUUID, targetUUID string, action ModerationAction, reason string) error {
+	if operatorUUID == targetUUID {
+		return ErrInvalidModeration
+	}
+
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		// 锁定双方的成员记录，避免并发的角色变更互相覆盖
+		var operator entity.RoomMembers
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("chat_user_uuid = ? AND room_uuid = ?", operatorUUID, roomUUID).First(&operator).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPermissionDenied
+			}
+			return err
+		}
+		var target entity.RoomMembers
+		targetErr := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("chat_user_uuid = ? AND room_uuid = ?", targetUUID, roomUUID).First(&target).Error
+		if targetErr != nil && !errors.Is(targetErr, gorm.ErrRecordNotFound) {
+			return targetErr
+		}
+		targetInRoom := targetErr == nil
+
+		switch action {
+		case KickMember, BanMember:
+			if roleRank(operator.Role) < roleRank(entity.RoomRoleAdmin) {
+				return ErrPermissionDenied
+			}
+			if !targetInRoom && action == KickMember {
+				return ErrTargetNotInRoom
+			}
+			if targetInRoom {
+				if roleRank(operator.Role) <= roleRank(target.Role) {
+					return ErrPermissionDenied
+				}
+				if err := tx.Where("chat_user_uuid = ? AND room_uuid = ?", targetUUID, roomUUID).
+					Delete(&entity.RoomMembers{}).Error; err != nil {
+					return err
+				}
+				// 与主动离开一致，被移出的成员不应在重新连接时收到移出前暂存的房间消息
+				if err := tx.Unscoped().Where("recipient_uuid = ? AND room_uuid = ?", targetUUID, roomUUID).
+					Delete(&entity.OfflineMessage{}).Error; err != nil {
+					return err
+				}
+			}
+			if action == BanMember {
+				return tx.Clauses(clause.OnConflict{
+					Columns:   []clause.Column{{Name: "room_uuid"}, {Name: "chat_user_uuid"}},
+					DoUpdates: clause.AssignmentColumns([]string{"banned_by", "reason", "updated_at"}),
+				}).Create(&entity.RoomBan{
+					RoomUUID:     roomUUID,
+					ChatUserUUID: targetUUID,
+					BannedBy:     operatorUUID,
+					Reason:       reason,
+				}).Error
+			}
+			return nil
+
+		case UnbanMember:
+			if roleRank(operator.Role) < roleRank(entity.RoomRoleAdmin) {
+				return ErrPermissionDenied
+			}
+			return tx.Unscoped().Where("chat_user_uuid = ? AND room_uuid = ?", targetUUID, roomUUID).
+				Delete(&entity.RoomBan{}).Error
+
+		case PromoteMember, DemoteMember, TransferOwnership:
+			if operator.Role != entity.RoomRoleOwner {
+				return ErrPermissionDenied
+			}
+			if !targetInRoom {
+				return ErrTargetNotInRoom
+			}
+			switch {
+			case action == PromoteMember && target.Role == entity.RoomRoleMember:
+				return tx.Model(&target).Update("role", entity.RoomRoleAdmin).Error
+			case action == DemoteMember && target.Role == entity.RoomRoleAdmin:
+				return tx.Model(&target).Update("role", entity.RoomRoleMember).Error
+			case action == TransferOwnership:
+				if err := tx.Model(&target).Update("role", entity.RoomRoleOwner).Error; err != nil {
+					return err
+				}
+				return tx.Model(&operator).Update("role", entity.RoomRoleAdmin).Error
+			}
+			return ErrInvalidModeration
+		}
+		return ErrInvalidModeration
+	})
+	if err != nil {
+		if !errors.Is(err, ErrPermissionDenied) && !errors.Is(err, ErrTargetNotInRoom) && !errors.Is(err, ErrInvalidModeration) {
+			global.Logger.Error("执行房间管理操作失败: ", zap.Error(err))
+		}
+		return err
+	}
+	return nil
+}
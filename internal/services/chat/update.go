@@ -1,8 +1,12 @@
 package chat
 
 import (
+	"errors"
+	"time"
+
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"qianmianyao/MistChat-Server/internal/models/entity"
 	"qianmianyao/MistChat-Server/pkg/global"
 )
@@ -26,11 +30,283 @@ func (u *Update) UserOnlineStatus(uuid string, isOnline bool) error {
 	return nil
 }
 
-// MarkUsed 标记 PreKey 为已使用
-func (f *Update) MarkUsed(preKeysID uint32) error {
-	err := f.db.Model(&entity.SignalPreKey{}).Where("pre_key_id = ?", preKeysID).Update("IsUsed", true).Error
+// UserLastSeen 记录用户最后一台设备断开连接的时间
+func (u *Update) UserLastSeen(uuid string) error {
+	err := u.db.Model(&entity.ChatUser{}).Where("uuid = ?", uuid).Update("last_seen_at", time.Now()).Error
+	if err != nil {
+		global.Logger.Error("更新用户最近在线时间失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// RotateRefreshToken 将用户当前有效的刷新令牌标识从 previousID 轮换为 nextID。
+// previousID 已不是当前标识（令牌已被使用或吊销）时不做修改并返回 false。
+func (u *Update) RotateRefreshToken(uuid, previousID, nextID string) (bool, error) {
+	result := u.db.Model(&entity.ChatUser{}).Where("uuid = ? AND refresh_token_id = ?", uuid, previousID).
+		Update("refresh_token_id", nextID)
+	if result.Error != nil {
+		global.Logger.Error("轮换刷新令牌失败: ", zap.Error(result.Error))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// UserHidePresence 更新用户是否对他人隐藏在线状态
+func (u *Update) UserHidePresence(uuid string, hide bool) error {
+	err := u.db.Model(&entity.ChatUser{}).Where("uuid = ?", uuid).Update("hide_presence", hide).Error
+	if err != nil {
+		global.Logger.Error("更新在线状态隐私设置失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// DeviceLastSeen 记录设备最近一次断开连接的时间
+func (u *Update) DeviceLastSeen(uuid string, deviceID int) error {
+	err := u.db.Model(&entity.Device{}).Where("chat_user_uuid = ? AND device_id = ?", uuid, deviceID).
+		Update("last_seen_at", time.Now()).Error
+	if err != nil {
+		global.Logger.Error("更新设备最近在线时间失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// MarkDelivered 将接收者的消息回执标记为已送达
+func (u *Update) MarkDelivered(recipientUUID string, messageIDs []string) error {
+	err := u.db.Model(&entity.MessageReceipt{}).
+		Where("recipient_uuid = ? AND message_id IN ? AND delivered_at IS NULL", recipientUUID, messageIDs).
+		Update("delivered_at", time.Now()).Error
+	if err != nil {
+		global.Logger.Error("标记消息已送达失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// MarkRead 将接收者的消息回执标记为已读，已读同时意味着已送达
+func (u *Update) MarkRead(recipientUUID string, messageIDs []string) error {
+	now := time.Now()
+	err := u.db.Model(&entity.MessageReceipt{}).
+		Where("recipient_uuid = ? AND message_id IN ? AND read_at IS NULL", recipientUUID, messageIDs).
+		Updates(map[string]any{
+			"read_at":      now,
+			"delivered_at": gorm.Expr("COALESCE(delivered_at, ?)", now),
+		}).Error
+	if err != nil {
+		global.Logger.Error("标记消息已读失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// DeactivateSupersededSignedPreKeys 停用宽限期已过且已被更新密钥取代的签名预密钥，返回停用数量
+func (u *Update) DeactivateSupersededSignedPreKeys(now int64) (int64, error) {
+	result := u.db.Model(&entity.SignalSignedPreKey{}).
+		Where("is_active = ? AND valid_until_timestamp < ?", true, now).
+		Where(`EXISTS (SELECT 1 FROM signal_signed_pre_keys AS newer
+			WHERE newer.chat_user_uuid = signal_signed_pre_keys.chat_user_uuid
+			AND newer.device_id = signal_signed_pre_keys.device_id
+			AND newer.is_active AND newer.id > signal_signed_pre_keys.id
+			AND newer.deleted_at IS NULL)`).
+		Update("is_active", false)
+	if result.Error != nil {
+		global.Logger.Error("停用过期 SignalSignedPreKey 失败: ", zap.Error(result.Error))
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// MarkSignedPreKeyExpiryNotified 标记签名预密钥已推送过到期提醒
+func (u *Update) MarkSignedPreKeyExpiryNotified(id uint) error {
+	err := u.db.Model(&entity.SignalSignedPreKey{}).Where("id = ?", id).Update("expiry_notified", true).Error
+	if err != nil {
+		global.Logger.Error("标记 SignalSignedPreKey 到期提醒失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// ReplaceSignalIdentityKey 替换设备的身份密钥。
+// 旧身份密钥写入历史表；旧身份签出的签名预密钥与一次性密钥全部作废，并在同一事务内写入新的签名预密钥与一次性预密钥。
+// 提交的身份密钥与当前相同时不写历史，返回的 changed 为 false。
+func (u *Update) ReplaceSignalIdentityKey(signalIdentityKey entity.SignalIdentityKey, signalSignedPreKey entity.SignalSignedPreKey,
+	signalPreKeys []entity.SignalPreKey) (changed bool, err error) {
+	err = u.db.Transaction(func(tx *gorm.DB) error {
+		var current entity.SignalIdentityKey
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("chat_user_uuid = ? AND device_id = ?", signalIdentityKey.ChatUserUUID, signalIdentityKey.DeviceID).
+			First(&current).Error; err != nil {
+			return err
+		}
+		// 提交的身份密钥与当前相同时只替换预密钥，不记录历史
+		changed = current.IdentityKey != signalIdentityKey.IdentityKey
+		if changed {
+			if err := tx.Create(&entity.SignalIdentityKeyHistory{
+				ChatUserUUID:   current.ChatUserUUID,
+				DeviceID:       current.DeviceID,
+				RegistrationID: current.RegistrationID,
+				IdentityKey:    current.IdentityKey,
+				ReplacedAt:     time.Now(),
+			}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&current).Updates(map[string]any{
+			"registration_id": signalIdentityKey.RegistrationID,
+			"identity_key":    signalIdentityKey.IdentityKey,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("chat_user_uuid = ? AND device_id = ?", current.ChatUserUUID, current.DeviceID).
+			Delete(&entity.SignalSignedPreKey{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("chat_user_uuid = ? AND device_id = ?", current.ChatUserUUID, current.DeviceID).
+			Delete(&entity.SignalPreKey{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&signalSignedPreKey).Error; err != nil {
+			return err
+		}
+		if len(signalPreKeys) > 0 {
+			return tx.Create(&signalPreKeys).Error
+		}
+		return nil
+	})
+	if err != nil {
+		global.Logger.Error("替换 SignalIdentityKey 失败: ", zap.Error(err))
+		return false, err
+	}
+	return changed, nil
+}
+
+// RoomPassword 更新房间密码哈希，用于将历史明文密码迁移为哈希
+func (u *Update) RoomPassword(roomUUID, hash string) error {
+	err := u.db.Model(&entity.Room{}).Where("uuid = ?", roomUUID).Update("password", hash).Error
+	if err != nil {
+		global.Logger.Error("更新房间密码失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// ConsumeRoomInvite 原子地消耗一次邀请码的使用次数，并将用户加入邀请所属房间。
+// 计数与有效性检查在同一条 UPDATE 中完成，并发加入不会超过 MaxUses；成员写入失败时次数随事务回滚。
+// 邀请无效时返回 gorm.ErrRecordNotFound。
+func (u *Update) ConsumeRoomInvite(code, uuid string) (entity.RoomInvite, error) {
+	var invite entity.RoomInvite
+	err := u.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&invite).Clauses(clause.Returning{}).
+			Where("code = ? AND (expires_at IS NULL OR expires_at > ?) AND (max_uses = 0 OR uses < max_uses)", code, time.Now()).
+			Update("uses", gorm.Expr("uses + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Create(&entity.RoomMembers{
+			ChatUserUUID: uuid,
+			RoomUUID:     invite.RoomUUID,
+			JoinTime:     time.Now(),
+			Role:         entity.RoomRoleMember,
+		}).Error
+	})
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			global.Logger.Error("使用房间邀请失败: ", zap.Error(err))
+		}
+		return invite, err
+	}
+	return invite, nil
+}
+
+// RoomArchived 归档或取消归档房间
+func (u *Update) RoomArchived(roomUUID string, archived bool) error {
+	var archivedAt *time.Time
+	if archived {
+		now := time.Now()
+		archivedAt = &now
+	}
+	err := u.db.Model(&entity.Room{}).Where("uuid = ?", roomUUID).Update("archived_at", archivedAt).Error
+	if err != nil {
+		global.Logger.Error("更新房间归档状态失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// RoomName 修改房间名称
+func (u *Update) RoomName(roomUUID, name string) error {
+	err := u.db.Model(&entity.Room{}).Where("uuid = ?", roomUUID).Update("name", name).Error
 	if err != nil {
-		global.Logger.Error("标记 PreKey 为已使用失败: ", zap.Error(err))
+		global.Logger.Error("修改房间名称失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// NextRoomSequence 原子地递增并返回房间的消息序号
+func (u *Update) NextRoomSequence(roomUUID string) (int64, error) {
+	var room entity.Room
+	result := u.db.Model(&room).Clauses(clause.Returning{Columns: []clause.Column{{Name: "last_seq"}}}).
+		Where("uuid = ?", roomUUID).
+		Update("last_seq", gorm.Expr("last_seq + 1"))
+	if result.Error != nil {
+		global.Logger.Error("分配房间消息序号失败: ", zap.Error(result.Error))
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return room.LastSeq, nil
+}
+
+// RoomMessageEnvelope 用编辑后的信封替换消息历史与尚未投递的离线队列中的原消息
+func (u *Update) RoomMessageEnvelope(messageID string, envelope []byte) error {
+	err := u.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.RoomMessage{}).Where("message_id = ?", messageID).
+			Update("envelope", string(envelope)).Error; err != nil {
+			return err
+		}
+		return tx.Model(&entity.OfflineMessage{}).Where("message_id = ?", messageID).
+			Update("envelope", string(envelope)).Error
+	})
+	if err != nil {
+		global.Logger.Error("编辑房间消息失败: ", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// AttachmentPart 记录附件第 part 个分片写入完成，只有 part 恰好是下一个待写入的分片时才会更新。
+// 分片已被其他请求记录或附件已完成时返回 gorm.ErrRecordNotFound。
+func (u *Update) AttachmentPart(attachmentID string, part int, size int64) (entity.Attachment, error) {
+	var attachment entity.Attachment
+	result := u.db.Model(&attachment).Clauses(clause.Returning{}).
+		Where("attachment_id = ? AND parts = ? AND completed_at IS NULL", attachmentID, part).
+		Updates(map[string]any{
+			"parts":    gorm.Expr("parts + 1"),
+			"received": gorm.Expr("received + ?", size),
+		})
+	if result.Error != nil {
+		global.Logger.Error("记录附件分片失败: ", zap.Error(result.Error))
+		return attachment, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return attachment, gorm.ErrRecordNotFound
+	}
+	return attachment, nil
+}
+
+// AttachmentCompleted 标记附件的所有分片已合并完成，并记录最终的尺寸
+func (u *Update) AttachmentCompleted(attachmentID string, width, height int) error {
+	if err := u.db.Model(&entity.Attachment{}).Where("attachment_id = ?", attachmentID).
+		Updates(map[string]any{"completed_at": time.Now(), "width": width, "height": height}).Error; err != nil {
+		global.Logger.Error("标记附件上传完成失败: ", zap.Error(err))
 		return err
 	}
 	return nil
@@ -0,0 +1,89 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/pkg/config"
+	"qianmianyao/MistChat-Server/pkg/global"
+	"qianmianyao/MistChat-Server/pkg/media"
+)
+
+// attachmentJanitorInterval 清理过期上传的检查间隔
+const attachmentJanitorInterval = time.Hour
+
+var (
+	errAttachmentNotFound   = errors.New("attachment not found")
+	errAttachmentIncomplete = errors.New("attachment upload is not complete")
+	errAttachmentMismatch   = errors.New("attachment metadata does not match the upload")
+)
+
+// checkAttachment 校验消息引用的附件已上传完成且属于同一房间。
+// 明文上传的附件由服务端校验过内容，消息声明的类型与尺寸必须与之一致，图片与视频消息只能引用对应类型的附件。
+func (h *Hub) checkAttachment(roomUUID string, msgType dot.MessageType, attachment *dot.Attachment) error {
+	if attachment == nil {
+		return nil
+	}
+	stored, err := h.chatFind.Attachment(attachment.Id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errAttachmentNotFound
+		}
+		return errors.New("internal error")
+	}
+	if stored.RoomUUID != roomUUID {
+		return errAttachmentNotFound
+	}
+	if stored.CompletedAt == nil {
+		return errAttachmentIncomplete
+	}
+	if !stored.Plaintext {
+		return nil
+	}
+
+	mimeType := media.BaseType(stored.MimeType)
+	if (msgType == dot.ImageMessage && !media.IsImage(mimeType)) || (msgType == dot.VideoMessage && !media.IsVideo(mimeType)) {
+		return errAttachmentMismatch
+	}
+	if attachment.Type != "" && media.BaseType(attachment.Type) != mimeType {
+		return errAttachmentMismatch
+	}
+	if stored.Width > 0 && (attachment.Width != 0 || attachment.Height != 0) &&
+		(attachment.Width != stored.Width || attachment.Height != stored.Height) {
+		return errAttachmentMismatch
+	}
+	return nil
+}
+
+// DeleteAttachmentContent 清理已删除记录的附件在存储中的内容，失败时只记录日志。
+func (h *Hub) DeleteAttachmentContent(attachmentIDs []string) {
+	for _, id := range attachmentIDs {
+		if err := h.storage.Delete(context.Background(), id); err != nil {
+			global.Logger.Warn(fmt.Sprintf("Failed to delete attachment content %s: %v", id, err))
+		}
+	}
+}
+
+// RunAttachmentJanitor 定期清理登记后超过 upload_ttl 仍未完成的上传，释放其占用的配额与存储。
+// upload_ttl 不大于 0 时不清理。
+func (h *Hub) RunAttachmentJanitor() {
+	ttl := config.GetConfig().Storage.UploadTTL
+	if ttl <= 0 {
+		global.Logger.Warn(fmt.Sprintf("upload_ttl 配置为 %v，不清理未完成的附件上传", ttl))
+		return
+	}
+	ticker := time.NewTicker(attachmentJanitorInterval)
+	defer ticker.Stop()
+
+	for {
+		if attachmentIDs, err := h.chatDelete.ExpiredAttachmentUploads(time.Now().Add(-ttl)); err == nil && len(attachmentIDs) > 0 {
+			h.DeleteAttachmentContent(attachmentIDs)
+			global.Logger.Info(fmt.Sprintf("已清理 %d 个过期的附件上传", len(attachmentIDs)))
+		}
+		<-ticker.C
+	}
+}
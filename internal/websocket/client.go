@@ -9,9 +9,11 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/models/entity"
 	"qianmianyao/MistChat-Server/internal/websocket/message_type"
-	"qianmianyao/MistChat-Server/pkg/encryption"
 	"qianmianyao/MistChat-Server/pkg/global"
+	"qianmianyao/MistChat-Server/pkg/ratelimit"
 )
 
 // WebSocket 连接相关的常量定义。
@@ -26,7 +28,8 @@ const (
 	pingPeriod = (pongWait * 9) / 10
 
 	// maxMessageSize 是允许从对端接收的 WebSocket 消息的最大大小（字节）。
-	maxMessageSize = 512
+	// 需容纳加密信封、预密钥包与批量确认等消息，因此设为 64 KiB。
+	maxMessageSize = 64 * 1024
 )
 
 var (
@@ -51,9 +54,19 @@ type Client struct {
 	conn     *websocket.Conn // WebSocket 连接。
 	send     chan []byte     // 发送消息的缓冲通道。
 	uuid     string          // 客户端唯一标识符 (User ID)。
+	deviceId int             // 客户端所在设备的设备号。
 	username string          // 客户端用户名。
 	isClosed bool            // 连接是否已关闭。
 	closeMu  sync.Mutex      // 用于保护 isClosed 状态的互斥锁。
+
+	sendClosed bool         // 发送通道是否已关闭。
+	sendMu     sync.RWMutex // 写入发送通道时持有读锁，关闭通道时持有写锁，避免向已关闭的通道写入。
+
+	offlineCursor uint       // 已投递给该连接的最大离线消息 ID。
+	offlineMu     sync.Mutex // 用于保护 offlineCursor 的互斥锁。
+
+	presenceSubscriptions map[string]bool        // 该连接订阅了在线状态的用户，由 Hub.presenceMu 保护。
+	typingLimiter         *ratelimit.TokenBucket // 限制该连接发送输入状态的频率。
 }
 
 // closeConnection 安全地关闭客户端连接，确保只关闭一次。
@@ -73,6 +86,34 @@ func (c *Client) closeConnection() bool {
 	return true
 }
 
+// trySend 在发送通道未关闭时非阻塞地写入消息，通道已关闭或发送缓冲已满时返回 false。
+// 所有向 send 写入的路径都必须经过此方法，计时器与后台 goroutine 可能在连接注销后才发送。
+func (c *Client) trySend(message []byte) bool {
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+
+	if c.sendClosed {
+		return false
+	}
+	select {
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeSend 关闭发送通道，确保只关闭一次，之后的 trySend 不再写入。
+func (c *Client) closeSend() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if !c.sendClosed {
+		c.sendClosed = true
+		close(c.send)
+	}
+}
+
 // readPump 从 WebSocket 连接读取消息并传递给 Hub 处理。
 // 同时处理连接关闭和 Pong 消息以维持连接。
 func (c *Client) readPump() {
@@ -106,20 +147,19 @@ func (c *Client) readPump() {
 		global.Logger.Debug(fmt.Sprintf("Received message from %s: %s", c.uuid, string(message))) // 可选调试日志
 
 		// 解析消息。
-		_, envelope, err := message_type.ParseMessage(message)
+		msg, envelope, err := message_type.ParseMessage(message)
 		if err != nil {
 			global.Logger.Warn(fmt.Sprintf("Failed to parse message from %s: %v", c.uuid, err))
 			continue
 		}
 
-		// 根据消息目标路由。
-		if envelope.Destination != "all" && envelope.Destination != "" {
-			// 发送给特定客户端或房间。
-			c.hub.SendToSpecificClient(envelope.Source.Uid, envelope.Destination, message)
-		} else {
-			// 广播消息（当前注释掉）。
-			c.hub.broadcast <- message
+		// 发送者必须与连接绑定的认证用户一致，防止冒充。
+		if envelope.Source.Uid != c.uuid {
+			global.Logger.Warn(fmt.Sprintf("Rejected message from %s with spoofed source %s", c.uuid, envelope.Source.Uid))
+			continue
 		}
+
+		c.dispatch(msg, envelope, message)
 	}
 }
 
@@ -197,25 +237,14 @@ func (c *Client) writePump() {
 }
 
 // ServeWs 处理 WebSocket 连接请求的 HTTP 处理器。
+// 连接绑定到经令牌认证的 user 及其已登记的 deviceId，而不是客户端自行提交的参数。
 // 负责升级连接、创建 Client、注册到 Hub 并启动读写 goroutine。
-func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	username := r.URL.Query().Get("username")
-	uuid := r.URL.Query().Get("uuid")
+func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, user entity.ChatUser, deviceId int) {
+	uuid := user.UUID
+	username := user.Username
 
-	if (username == "") || (uuid == "") {
-		http.Error(w, "Missing required query parameters.", http.StatusBadRequest)
-		return
-	}
-
-	// 验证 UID 格式。
-	if ok, err := encryption.ValidateUID(uuid, "u_"); err != nil || !ok {
-		global.Logger.Warn(fmt.Sprintf("Invalid UID provided or generated: %s, validation error: %v", uuid, err))
-		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
-		return
-	}
-
-	// 检查用户是否已经有活跃连接
-	if existingClient, exists := hub.GetClientByUUID(uuid); exists {
+	// 检查该设备是否已经有活跃连接
+	if existingClient, exists := hub.GetClient(uuid, deviceId); exists {
 		// 关闭旧连接
 		if existingClient.closeConnection() {
 			// 取消注册旧客户端
@@ -247,19 +276,27 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		conn:     conn,
 		send:     make(chan []byte, 256),
 		uuid:     uuid,
+		deviceId: deviceId,
 		username: username,
 		isClosed: false,
+
+		presenceSubscriptions: make(map[string]bool),
+		typingLimiter:         ratelimit.NewTokenBucket(typingRate, typingBurst),
 	}
 
 	// 注册客户端到 Hub。
 	client.hub.register <- client
 
 	// 创建并发送欢迎消息。
-	welcomeMessage, err := message_type.NewSystemMessage("connect success!").SerializeWithArgs()
+	welcomeMessage, err := message_type.NewSystemMessage(dot.ConnectedNotice{
+		Event:    dot.ConnectedEvent,
+		UUID:     client.uuid,
+		DeviceId: client.deviceId,
+	}).SerializeWithArgs()
 	if err != nil {
 		global.Logger.Error(fmt.Sprintf("Failed to serialize welcome message for %s: %v", client.uuid, err))
 	} else {
-		client.send <- welcomeMessage // 将欢迎消息放入发送通道
+		client.trySend(welcomeMessage) // 将欢迎消息放入发送通道
 	}
 
 	// 启动后台 goroutine 处理读写。
@@ -0,0 +1,118 @@
+package websocket
+
+import (
+	"fmt"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/models/entity"
+	"qianmianyao/MistChat-Server/internal/websocket/message_type"
+	"qianmianyao/MistChat-Server/pkg/encryption"
+	"qianmianyao/MistChat-Server/pkg/global"
+)
+
+// dispatch 根据消息类型处理客户端发来的消息。
+// 控制类消息由 Hub 直接处理，其余消息按目标路由。
+func (c *Client) dispatch(msg message_type.Message, envelope dot.Envelope, message []byte) {
+	switch m := msg.(type) {
+	case *message_type.AckMessage:
+		c.hub.acknowledgeOfflineMessages(c, m.QueueIds)
+		return
+	case *message_type.ReceiptMessage:
+		c.hub.handleReceipt(c, m)
+		return
+	case *message_type.SenderKeyDistributionMessage:
+		c.hub.routeSenderKeyDistribution(c, m, envelope.Destination, message)
+		return
+	case *message_type.ModerationMessage:
+		c.hub.handleModeration(c, m, envelope.Destination)
+		return
+	case *message_type.PresenceMessage:
+		c.hub.handlePresence(c, m)
+		return
+	case *message_type.TypingMessage:
+		c.hub.handleTyping(c, m, envelope.Destination)
+		return
+	case *message_type.HistoryMessage:
+		c.hub.handleHistory(c, m, envelope.Destination)
+		return
+	case *message_type.MutationMessage:
+		c.hub.handleMutation(c, m, envelope, message)
+		return
+	case *message_type.ReactionMessage:
+		c.hub.handleReaction(c, m, envelope, message)
+		return
+	}
+
+	if envelope.Destination != "all" && envelope.Destination != "" {
+		c.routeToRoom(envelope, message)
+	} else {
+		// 广播消息。
+		c.hub.broadcast <- message
+	}
+}
+
+// routeToRoom 校验回复、话题与附件引用后，为发往房间的消息分配全局唯一的消息 ID 与房间内单调递增的序号后转发给房间成员，
+// 并通过 server_ack 将分配结果回传给发送连接。
+func (c *Client) routeToRoom(envelope dot.Envelope, message []byte) {
+	roomUUID := envelope.Destination
+	if err := c.hub.canSendToRoom(c.uuid, roomUUID); err != nil {
+		c.hub.sendServerAck(c, roomUUID, dot.ServerAck{Nonce: envelope.Nonce, Error: err.Error()})
+		return
+	}
+
+	if err := c.hub.checkReferences(envelope); err != nil {
+		c.hub.sendServerAck(c, roomUUID, dot.ServerAck{Nonce: envelope.Nonce, Error: err.Error()})
+		return
+	}
+	if err := c.hub.checkAttachment(roomUUID, envelope.Message.Type, envelope.Message.Content.Attachment); err != nil {
+		c.hub.sendServerAck(c, roomUUID, dot.ServerAck{Nonce: envelope.Nonce, Error: err.Error()})
+		return
+	}
+
+	messageID, err := encryption.GenerateUID("m_")
+	if err != nil {
+		global.Logger.Error(fmt.Sprintf("Failed to generate message ID for %s: %v", c.uuid, err))
+		c.hub.sendServerAck(c, roomUUID, dot.ServerAck{Nonce: envelope.Nonce, Error: "internal error"})
+		return
+	}
+	seq, err := c.hub.chatUpdate.NextRoomSequence(roomUUID)
+	if err != nil {
+		c.hub.sendServerAck(c, roomUUID, dot.ServerAck{Nonce: envelope.Nonce, Error: "internal error"})
+		return
+	}
+	stamped, err := setEnvelopeFields(message, map[string]any{"id": messageID, "seq": seq})
+	if err != nil {
+		global.Logger.Warn(fmt.Sprintf("Failed to stamp message from %s: %v", c.uuid, err))
+		return
+	}
+
+	// 历史写入失败不影响实时投递
+	_ = c.hub.chatCreate.RoomMessage(&entity.RoomMessage{
+		MessageID:  messageID,
+		RoomUUID:   roomUUID,
+		Seq:        seq,
+		SenderUUID: c.uuid,
+		ReplyTo:    envelope.ReplyTo,
+		ThreadRoot: envelope.ThreadRoot,
+		Envelope:   string(stamped),
+	})
+
+	recipients := c.hub.SendToSpecificClient(c, roomUUID, messageID, stamped)
+	if err := c.hub.chatCreate.MessageReceipts(messageID, roomUUID, c.uuid, recipients); err != nil {
+		global.Logger.Warn(fmt.Sprintf("Failed to record receipts for %s", messageID))
+	}
+	c.hub.sendServerAck(c, roomUUID, dot.ServerAck{Nonce: envelope.Nonce, Id: messageID, Seq: seq})
+}
+
+// sendServerAck 向发送连接回复受理结果，客户端未提供 nonce 时不回复。
+func (h *Hub) sendServerAck(client *Client, roomUUID string, ack dot.ServerAck) {
+	if ack.Nonce == "" {
+		return
+	}
+	message, err := message_type.NewServerAckMessage(ack).SerializeWithArgs(roomUUID)
+	if err != nil {
+		global.Logger.Error(fmt.Sprintf("Failed to serialize server ack for %s: %v", client.uuid, err))
+		return
+	}
+	h.sendToClients([]*Client{client}, message)
+}
@@ -0,0 +1,21 @@
+package websocket
+
+import "encoding/json"
+
+// setEnvelopeFields 在不改动其余字段（包括客户端密文）的前提下为原始信封写入服务端字段。
+// 客户端 nonce 只通过 server_ack 回传给发送连接，经此处理后用于转发或存储的信封一律移除该字段。
+func setEnvelopeFields(envelope []byte, values map[string]any) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(envelope, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "nonce")
+	for key, value := range values {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		fields[key] = raw
+	}
+	return json.Marshal(fields)
+}
@@ -0,0 +1,77 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/services/chat"
+	"qianmianyao/MistChat-Server/internal/websocket/message_type"
+	"qianmianyao/MistChat-Server/pkg/global"
+)
+
+// defaultHistoryLimit 未指定条数时返回的历史消息条数
+const defaultHistoryLimit = 50
+
+// RoomHistory 返回房间内序号小于 before 的历史消息，thread 不为空时只返回该话题内的回复，只有房间的当前成员可以查询。
+// 消息按序号升序排列，NextBefore 为继续向前翻页时使用的游标，Reactions 为这些消息的表情回应统计。
+func (h *Hub) RoomHistory(uuid, roomUUID, thread string, before int64, limit int) (dot.History, error) {
+	if h.chatFind.IsTheUserIsInTheRoom(uuid, roomUUID) == chat.NotInRoom {
+		return dot.History{}, ErrNotInRoom
+	}
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+
+	messages, hasMore, err := h.chatFind.RoomMessages(roomUUID, thread, before, limit)
+	if err != nil {
+		return dot.History{}, err
+	}
+	history := dot.History{
+		Thread:   thread,
+		Messages: make([]json.RawMessage, 0, len(messages)),
+		HasMore:  hasMore,
+	}
+	messageIDs := make([]string, 0, len(messages))
+	// 查询结果为倒序，转为升序便于客户端按顺序渲染
+	for i := len(messages) - 1; i >= 0; i-- {
+		history.Messages = append(history.Messages, json.RawMessage(messages[i].Envelope))
+		messageIDs = append(messageIDs, messages[i].MessageID)
+	}
+
+	counts, err := h.chatFind.ReactionCounts(messageIDs, uuid)
+	if err != nil {
+		return dot.History{}, err
+	}
+	if len(counts) > 0 {
+		history.Reactions = make(map[string][]dot.ReactionCount, len(counts))
+		for messageID, reactions := range counts {
+			for _, r := range reactions {
+				history.Reactions[messageID] = append(history.Reactions[messageID], dot.ReactionCount{
+					Emoji:   r.Emoji,
+					Count:   r.Count,
+					Reacted: r.Reacted,
+				})
+			}
+		}
+	}
+	if hasMore {
+		history.NextBefore = messages[len(messages)-1].Seq
+	}
+	return history, nil
+}
+
+// handleHistory 处理客户端通过 WebSocket 发起的历史消息请求，并把结果回复给请求连接。
+func (h *Hub) handleHistory(client *Client, msg *message_type.HistoryMessage, roomUUID string) {
+	history, err := h.RoomHistory(client.uuid, roomUUID, msg.History.Thread, msg.History.Before, msg.History.Limit)
+	if err != nil {
+		history = dot.History{Error: err.Error()}
+	}
+
+	message, err := message_type.NewHistoryMessage(history).SerializeWithArgs(roomUUID)
+	if err != nil {
+		global.Logger.Error(fmt.Sprintf("Failed to serialize history for %s: %v", client.uuid, err))
+		return
+	}
+	h.sendToClients([]*Client{client}, message)
+}
@@ -1,11 +1,14 @@
 package websocket
 
 import (
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"qianmianyao/MistChat-Server/internal/services/chat"
 	"qianmianyao/MistChat-Server/pkg/global"
+	"qianmianyao/MistChat-Server/pkg/storage"
 )
 
 // Hub 负责管理 WebSocket 客户端连接、注册、注销以及消息广播。
@@ -24,37 +27,83 @@ type Hub struct {
 	chatUpdate *chat.Update
 	// chatFind 用于处理聊天相关的查找操作。
 	chatFind *chat.Find
+	// chatDelete 用于处理聊天相关的删除操作。
+	chatDelete *chat.Delete
+	// chatModeration 用于执行房间管理操作。
+	chatModeration *chat.Moderation
 	// clientsMutex 用于保护 clients 和 usersClients 的互斥锁
 	clientsMutex sync.RWMutex
+	// presenceSubscribers 记录订阅了某个用户在线状态的连接：uuid -> 订阅连接。
+	presenceSubscribers map[string]map[*Client]bool
+	// presenceMu 用于保护 presenceSubscribers 与各连接的订阅集合。
+	presenceMu sync.Mutex
+	// typing 记录正在输入的用户及其过期计时器。
+	typing map[typingKey]*time.Timer
+	// typingMu 用于保护 typing。
+	typingMu sync.Mutex
+	// storage 附件存储后端，删除附件记录后用于清理其内容。
+	storage storage.Storage
 }
 
-// NewHub 创建并返回一个新的 Hub 实例。
-func NewHub() *Hub {
+// NewHub 创建并返回一个新的 Hub 实例，attachmentStorage 为附件存储后端。
+func NewHub(attachmentStorage storage.Storage) *Hub {
 	return &Hub{
-		broadcast:    make(chan []byte),
-		register:     make(chan *Client),
-		unregister:   make(chan *Client),
-		clients:      make(map[*Client]bool),
-		chatCreate:   chat.NewCreate(),
-		chatUpdate:   chat.NewUpdate(),
-		chatFind:     chat.NewFind(),
-		clientsMutex: sync.RWMutex{},
+		broadcast:      make(chan []byte),
+		register:       make(chan *Client),
+		unregister:     make(chan *Client),
+		clients:        make(map[*Client]bool),
+		chatCreate:     chat.NewCreate(),
+		chatUpdate:     chat.NewUpdate(),
+		chatFind:       chat.NewFind(),
+		chatDelete:     chat.NewDelete(),
+		chatModeration: chat.NewModeration(),
+		clientsMutex:   sync.RWMutex{},
+
+		presenceSubscribers: make(map[string]map[*Client]bool),
+		typing:              make(map[typingKey]*time.Timer),
+		storage:             attachmentStorage,
 	}
 }
 
+// 消息被拒绝的原因，会在 server_ack 中回传给发送者
 var (
-	usersClients   = make(map[string]*Client)
+	ErrNotInRoom      = errors.New("not in room")
+	errBannedFromRoom = errors.New("banned from room")
+	errRoomArchived   = errors.New("room archived")
+)
+
+// usersClients 按用户索引其所有在线设备的连接：uuid -> deviceId -> *Client。
+var (
+	usersClients   = make(map[string]map[int]*Client)
 	usersClientsMu sync.RWMutex
 )
 
-// GetClientByUUID 根据UUID获取客户端连接
-func (h *Hub) GetClientByUUID(uuid string) (*Client, bool) {
+// GetClient 获取用户指定设备的客户端连接
+func (h *Hub) GetClient(uuid string, deviceId int) (*Client, bool) {
 	usersClientsMu.RLock()
 	defer usersClientsMu.RUnlock()
-	client, exists := usersClients[uuid]
+	client, exists := usersClients[uuid][deviceId]
 	return client, exists
 }
 
+// GetClientsByUUID 根据UUID获取用户所有在线设备的客户端连接
+func (h *Hub) GetClientsByUUID(uuid string) []*Client {
+	usersClientsMu.RLock()
+	defer usersClientsMu.RUnlock()
+	clients := make([]*Client, 0, len(usersClients[uuid]))
+	for _, client := range usersClients[uuid] {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// IsOnline 判断用户当前是否至少有一台设备在线
+func (h *Hub) IsOnline(uuid string) bool {
+	usersClientsMu.RLock()
+	defer usersClientsMu.RUnlock()
+	return len(usersClients[uuid]) > 0
+}
+
 // Run 启动 Hub 的主事件循环，监听并处理客户端注册、注销和消息广播事件。
 func (h *Hub) Run() {
 	for {
@@ -82,22 +131,34 @@ func (h *Hub) clientRegister(client *Client) {
 	}
 
 	h.clientsMutex.Lock()
-	defer h.clientsMutex.Unlock()
-
-	// 如果该用户已有连接，先关闭旧连接
-	if oldClient, exists := usersClients[client.uuid]; exists && oldClient != client {
-		global.Logger.Warn(fmt.Sprintf("用户在 %s 中已有一个活动连接，正在关闭", client.uuid))
+	usersClientsMu.Lock()
+	// 同一设备只保留一个连接，如果该设备已有连接，先关闭旧连接
+	if oldClient, exists := usersClients[client.uuid][client.deviceId]; exists && oldClient != client {
+		global.Logger.Warn(fmt.Sprintf("用户 %s 的设备 %d 已有一个活动连接，正在关闭", client.uuid, client.deviceId))
 		delete(h.clients, oldClient)
-		close(oldClient.send)
+		h.unsubscribeAllPresence(oldClient)
+		oldClient.closeSend()
+	}
+	// 用户的第一台设备连接时才视为上线
+	firstDevice := len(usersClients[client.uuid]) == 0
+	if firstDevice {
+		usersClients[client.uuid] = make(map[int]*Client)
 	}
+	usersClients[client.uuid][client.deviceId] = client
+	usersClientsMu.Unlock()
 
 	h.clients[client] = true
-
-	usersClientsMu.Lock()
-	usersClients[client.uuid] = client
-	usersClientsMu.Unlock()
+	h.clientsMutex.Unlock()
 
 	global.Logger.Debug(fmt.Sprintf("客户端 %v 已连接", client))
+
+	// 补发离线消息需要读写数据库，在释放 clientsMutex 后进行，避免阻塞其他连接的注册与广播。
+	// 注销同样在 Run 中串行处理，此时 client.send 不会被关闭。
+	h.flushOfflineMessages(client)
+	h.CheckPreKeyPool(client.uuid, client.deviceId)
+	if firstDevice {
+		go h.broadcastPresence(client.uuid, true)
+	}
 }
 
 // clientUnregister unregisters a client
@@ -106,21 +167,34 @@ func (h *Hub) clientUnregister(client *Client) {
 	defer h.clientsMutex.Unlock()
 
 	if _, ok := h.clients[client]; ok {
-		if r := h.chatFind.IsUserExist(client.uuid); r == chat.UserExist {
-			if err := h.chatUpdate.UserOnlineStatus(client.uuid, false); err != nil {
-				return
-			}
-		}
-
-		// 从在线用户列表中删除
+		// 从在线设备列表中删除
 		usersClientsMu.Lock()
-		if currentClient, exists := usersClients[client.uuid]; exists && currentClient == client {
+		if currentClient, exists := usersClients[client.uuid][client.deviceId]; exists && currentClient == client {
+			delete(usersClients[client.uuid], client.deviceId)
+		}
+		lastDevice := len(usersClients[client.uuid]) == 0
+		if lastDevice {
 			delete(usersClients, client.uuid)
 		}
 		usersClientsMu.Unlock()
 
 		delete(h.clients, client)
-		close(client.send) // 确保发送通道被关闭
+		h.unsubscribeAllPresence(client)
+		client.closeSend() // 确保发送通道被关闭
+
+		if err := h.chatUpdate.DeviceLastSeen(client.uuid, client.deviceId); err != nil {
+			global.Logger.Warn(fmt.Sprintf("更新设备 %s/%d 最近在线时间失败", client.uuid, client.deviceId))
+		}
+		// 用户的最后一台设备断开后才视为离线
+		if lastDevice {
+			if err := h.chatUpdate.UserOnlineStatus(client.uuid, false); err != nil {
+				return
+			}
+			if err := h.chatUpdate.UserLastSeen(client.uuid); err != nil {
+				global.Logger.Warn(fmt.Sprintf("更新用户 %s 最近在线时间失败", client.uuid))
+			}
+			go h.broadcastPresence(client.uuid, false)
+		}
 	}
 }
 
@@ -130,54 +204,130 @@ func (h *Hub) Broadcast(message []byte) {
 	defer h.clientsMutex.RUnlock()
 
 	for client := range h.clients {
-		select {
-		case client.send <- message:
+		if client.trySend(message) {
 			global.Logger.Debug(fmt.Sprintf("发送给客户: %v", client))
-		default:
-			go func(c *Client) {
-				h.unregister <- c
-			}(client)
+			continue
 		}
+		go func(c *Client) {
+			h.unregister <- c
+		}(client)
 	}
 }
 
-// SendToSpecificClient 将消息发送给指定房间内除发送者外的所有其他客户端。
-// uuid: 发送者客户端的UUID。
+// SendToSpecificClient 将消息发送给指定房间内所有成员的所有设备（发送连接本身除外），并返回接收者列表。
+// messageID 为服务端分配的消息 ID，随离线暂存一起保存，以便撤回或编辑时同步修改离线队列。
+// 发送者的其他设备同样会收到消息以保持同步，但发送者不计入接收者。
+// 不在线或发送缓冲已满的设备会收到离线暂存，待其下次连接时补发。
+// 调用方须事先通过 canSendToRoom 校验发送权限。
+// sender: 发送消息的客户端连接。
 // roomUUID: 目标房间的UUID。
+// messageID: 服务端分配的消息 ID。
 // message: 要发送的消息内容。
-func (h *Hub) SendToSpecificClient(uuid, roomUUID string, message []byte) {
+func (h *Hub) SendToSpecificClient(sender *Client, roomUUID, messageID string, message []byte) []string {
 	// 获取房间内所有的用户
 	users := h.chatFind.AllUsersInTheRoom(roomUUID)
 
-	roomstatus := h.chatFind.IsTheUserIsInTheRoom(uuid, roomUUID)
-	if roomstatus == chat.NotInRoom {
-		global.Logger.Debug(fmt.Sprintf("用户 %s 不在房间 %s 内", uuid, roomUUID))
+	var recipients []string
+	for _, uid := range users {
+		if uid != sender.uuid {
+			recipients = append(recipients, uid)
+		}
+	}
+
+	h.deliverMessage(users, roomUUID, messageID, message, sender)
+	return recipients
+}
+
+// canSendToRoom 检查用户能否向房间发送消息：必须是房间成员、未被封禁且房间未归档。
+func (h *Hub) canSendToRoom(uuid, roomUUID string) error {
+	if h.chatFind.IsTheUserIsInTheRoom(uuid, roomUUID) == chat.NotInRoom {
+		return ErrNotInRoom
+	}
+	if h.chatFind.IsBanned(uuid, roomUUID) {
+		return errBannedFromRoom
+	}
+	if h.chatFind.IsRoomArchived(roomUUID) {
+		return errRoomArchived
+	}
+	return nil
+}
+
+// SendToUser 将消息发送给指定用户的所有设备，不在线的设备暂存为离线消息。
+func (h *Hub) SendToUser(uuid, roomUUID string, message []byte) {
+	h.deliver([]string{uuid}, roomUUID, message, nil)
+}
+
+// SendToDevice 将消息发送给用户的指定设备，设备不在线时暂存为离线消息。
+func (h *Hub) SendToDevice(uuid string, deviceId int, message []byte) {
+	h.sendToDeviceInRoom(uuid, deviceId, "", message)
+}
+
+// sendToDeviceInRoom 将属于房间的消息发送给用户的指定设备，离线暂存记录所属房间，成员离开房间时随之清除。
+func (h *Hub) sendToDeviceInRoom(uuid string, deviceId int, roomUUID string, message []byte) {
+	if client, ok := h.GetClient(uuid, deviceId); ok {
+		if client.trySend(message) {
+			return
+		}
+		go func(c *Client) {
+			h.unregister <- c
+		}(client)
+	}
+	if err := h.chatCreate.OfflineMessage(uuid, deviceId, roomUUID, "", message); err != nil {
+		global.Logger.Warn(fmt.Sprintf("设备 %s/%d 的离线消息暂存失败", uuid, deviceId))
+	}
+}
+
+// deliver 将消息投递给用户们登记过的所有设备，跳过 except 连接。
+// 在线设备直接写入发送通道，离线或发送缓冲已满的设备写入离线队列。
+func (h *Hub) deliver(users []string, roomUUID string, message []byte, except *Client) {
+	h.deliverMessage(users, roomUUID, "", message, except)
+}
+
+// deliverMessage 与 deliver 相同，写入离线队列时同时记录消息 ID。
+func (h *Hub) deliverMessage(users []string, roomUUID, messageID string, message []byte, except *Client) {
+	deviceIDs, err := h.chatFind.DeviceIDsOfUsers(users)
+	if err != nil {
 		return
 	}
 
-	// 获取房间内所有的在线用户
+	type target struct {
+		uuid     string
+		deviceId int
+	}
 	var clients []*Client
+	var offline []target
 
 	usersClientsMu.RLock()
 	for _, uid := range users {
-		if client, ok := usersClients[uid]; ok {
-			// 不对自己发送消息
-			if client.uuid == uuid {
+		for _, deviceId := range deviceIDs[uid] {
+			client, ok := usersClients[uid][deviceId]
+			if ok && client == except {
 				continue
 			}
-			clients = append(clients, client)
+			if ok {
+				clients = append(clients, client)
+			} else {
+				offline = append(offline, target{uuid: uid, deviceId: deviceId})
+			}
 		}
 	}
 	usersClientsMu.RUnlock()
 
 	for _, client := range clients {
-		select {
-		case client.send <- message:
+		if client.trySend(message) {
 			global.Logger.Debug(fmt.Sprintf("发送给用户: %v", client))
-		default:
-			go func(c *Client) {
-				h.unregister <- c
-			}(client)
+			continue
+		}
+		// 连接已注销或发送缓冲已满，改为离线暂存
+		offline = append(offline, target{uuid: client.uuid, deviceId: client.deviceId})
+		go func(c *Client) {
+			h.unregister <- c
+		}(client)
+	}
+
+	for _, t := range offline {
+		if err := h.chatCreate.OfflineMessage(t.uuid, t.deviceId, roomUUID, messageID, message); err != nil {
+			global.Logger.Warn(fmt.Sprintf("设备 %s/%d 的离线消息暂存失败", t.uuid, t.deviceId))
 		}
 	}
 }
@@ -0,0 +1,32 @@
+package websocket
+
+import (
+	"fmt"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/websocket/message_type"
+	"qianmianyao/MistChat-Server/pkg/global"
+)
+
+// NotifyIdentityKeyChanged 通知与该用户共享房间的所有用户及其本人的其他设备：该设备的身份密钥已变更。
+// 离线用户会在下次连接时收到，以便客户端显示“安全码已变更”提示。
+func (h *Hub) NotifyIdentityKeyChanged(uuid string, deviceId int) {
+	peers, err := h.chatFind.RoomPeers(uuid)
+	if err != nil {
+		return
+	}
+
+	notice, err := message_type.NewSystemMessage(dot.IdentityKeyChangedNotice{
+		Event:    dot.IdentityKeyChangedEvent,
+		UUID:     uuid,
+		DeviceId: deviceId,
+	}).SerializeWithArgs()
+	if err != nil {
+		global.Logger.Error(fmt.Sprintf("Failed to serialize identity key notice for %s/%d: %v", uuid, deviceId, err))
+		return
+	}
+
+	for _, peer := range append(peers, uuid) {
+		h.SendToUser(peer, "", notice)
+	}
+}
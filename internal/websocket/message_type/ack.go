@@ -0,0 +1,36 @@
+package message_type
+
+import (
+	"errors"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+)
+
+// maxAckQueueIds 单条 ack 消息最多确认的离线消息数，服务端每批最多补发 100 条，留出合并确认的余量
+const maxAckQueueIds = 500
+
+// AckMessage 代表客户端对离线消息的确认，只由客户端发送给服务端。
+type AckMessage struct {
+	BaseMessage[[]uint]
+	QueueIds []uint `json:"queueIds"` // 已确认的离线消息 ID
+}
+
+// NewAckMessage 创建并返回一个新的 AckMessage 实例。
+func NewAckMessage(queueIds []uint) *AckMessage {
+	msg := &AckMessage{QueueIds: queueIds}
+	msg.MessageType = dot.AckMessage
+	msg.BaseMessage.child = msg
+	return msg
+}
+
+// LoadFromEnvelope 从给定的 dot.Envelope 中加载数据到 AckMessage。
+func (a *AckMessage) LoadFromEnvelope(env dot.Envelope) error {
+	if env.Message.Content.Ack == nil || len(env.Message.Content.Ack.QueueIds) == 0 {
+		return errors.New("ack message requires at least one queueId")
+	}
+	if len(env.Message.Content.Ack.QueueIds) > maxAckQueueIds {
+		return errors.New("too many queueIds in one ack message")
+	}
+	a.QueueIds = env.Message.Content.Ack.QueueIds
+	return nil
+}
@@ -0,0 +1,49 @@
+package message_type
+
+import (
+	"errors"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+)
+
+// maxMediaDimension 图片与视频声明的宽高上限，与上传接口一致
+const maxMediaDimension = 16384
+
+// AttachmentMessage 代表图片、视频或文件消息，类型为 image、video 或 file。
+// 附件密文通过上传接口单独上传，消息中只携带附件 ID 与元数据。
+type AttachmentMessage struct {
+	BaseMessage[dot.Attachment]
+	Attachment dot.Attachment `json:"attachment"`
+}
+
+// NewAttachmentMessage 创建并返回一个新的 AttachmentMessage 实例，msgType 只能是 image、video 或 file。
+func NewAttachmentMessage(msgType dot.MessageType) *AttachmentMessage {
+	msg := &AttachmentMessage{}
+	msg.MessageType = msgType
+	msg.BaseMessage.child = msg
+	return msg
+}
+
+// LoadFromEnvelope 从给定的 dot.Envelope 中加载数据到 AttachmentMessage。
+func (a *AttachmentMessage) LoadFromEnvelope(env dot.Envelope) error {
+	if env.Destination == "" || env.Destination == "all" {
+		return errors.New("attachment message requires a room destination")
+	}
+	attachment := env.Message.Content.Attachment
+	if attachment == nil || attachment.Id == "" {
+		return errors.New("attachment message requires an uploaded attachment id")
+	}
+	if attachment.Size < 0 {
+		return errors.New("invalid attachment size")
+	}
+	if a.MessageType == dot.ImageMessage || a.MessageType == dot.VideoMessage {
+		// 尺寸要么都不填，要么都在合理范围内
+		validWidth := attachment.Width > 0 && attachment.Width <= maxMediaDimension
+		validHeight := attachment.Height > 0 && attachment.Height <= maxMediaDimension
+		if (attachment.Width != 0 || attachment.Height != 0) && !(validWidth && validHeight) {
+			return errors.New("invalid attachment dimensions")
+		}
+	}
+	a.Attachment = *attachment
+	return nil
+}
@@ -0,0 +1,65 @@
+package message_type
+
+import (
+	"errors"
+	"time"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+)
+
+// maxHistoryLimit 单次请求最多返回的历史消息条数
+const maxHistoryLimit = 100
+
+// HistoryMessage 代表房间消息历史的请求或回复。
+type HistoryMessage struct {
+	BaseMessage[dot.History]
+	History dot.History `json:"history"`
+}
+
+// NewHistoryMessage 创建并返回一个新的 HistoryMessage 实例。
+func NewHistoryMessage(history dot.History) *HistoryMessage {
+	msg := &HistoryMessage{History: history}
+	msg.MessageType = dot.HistoryMessage
+	msg.BaseMessage.child = msg
+	return msg
+}
+
+// StructureMessage 根据历史查询结果构建回复给请求连接的 dot.Envelope。
+// args 可选传入房间的 UUID。
+func (h *HistoryMessage) StructureMessage(args ...any) *dot.Envelope {
+	var destination string
+	if len(args) == 1 {
+		destination, _ = args[0].(string)
+	}
+
+	history := h.History
+	return &dot.Envelope{
+		Source: dot.Source{
+			Uid:  "system",
+			Name: "System",
+		},
+		Message: dot.DataMessage{
+			Type: dot.HistoryMessage,
+			Content: dot.Content{
+				History: &history,
+			},
+		},
+		Destination: destination,
+		Timestamp:   time.Now(),
+	}
+}
+
+// LoadFromEnvelope 从给定的 dot.Envelope 中加载历史请求参数到 HistoryMessage。
+func (h *HistoryMessage) LoadFromEnvelope(env dot.Envelope) error {
+	if env.Destination == "" || env.Destination == "all" {
+		return errors.New("history request requires a room destination")
+	}
+	if env.Message.Content.History != nil {
+		request := env.Message.Content.History
+		if request.Before < 0 || request.Limit < 0 || request.Limit > maxHistoryLimit {
+			return errors.New("invalid history cursor or limit")
+		}
+		h.History = dot.History{Thread: request.Thread, Before: request.Before, Limit: request.Limit}
+	}
+	return nil
+}
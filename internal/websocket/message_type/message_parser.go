@@ -20,9 +20,31 @@ func ParseMessage(data []byte) (Message, dot.Envelope, error) {
 	var msg Message
 	switch envelope.Message.Type {
 	case dot.SystemMessage:
-		msg = NewSystemMessage("")
+		msg = NewSystemMessage(nil)
 	case dot.TextMessage:
 		msg = NewTextMessage("")
+	case dot.AckMessage:
+		msg = NewAckMessage(nil)
+	case dot.DeliveredMessage, dot.ReadMessage:
+		msg = NewReceiptMessage(envelope.Message.Type, nil)
+	case dot.SenderKeyDistributionMessage:
+		msg = NewSenderKeyDistributionMessage(dot.SenderKeyDistribution{})
+	case dot.ModerationMessage:
+		msg = NewModerationMessage(dot.Moderation{})
+	case dot.PresenceSubscribeMessage, dot.PresenceUnsubscribeMessage:
+		msg = NewPresenceMessage(envelope.Message.Type, nil)
+	case dot.TypingStartMessage, dot.TypingStopMessage:
+		msg = NewTypingMessage(envelope.Message.Type)
+	case dot.ServerAckMessage:
+		msg = NewServerAckMessage(dot.ServerAck{})
+	case dot.HistoryMessage:
+		msg = NewHistoryMessage(dot.History{})
+	case dot.EditMessage, dot.DeleteMessage:
+		msg = NewMutationMessage(envelope.Message.Type)
+	case dot.ReactionMessage:
+		msg = NewReactionMessage()
+	case dot.ImageMessage, dot.VideoMessage, dot.FileMessage:
+		msg = NewAttachmentMessage(envelope.Message.Type)
 	// TODO: 在这里添加其他消息类型的处理
 	default:
 		return nil, envelope, errors.New("未知的消息类型: " + string(envelope.Message.Type))
@@ -55,9 +77,31 @@ func ParseMessageType(data []byte) (dot.MessageType, error) {
 func CreateMessage(msgType dot.MessageType) (Message, error) {
 	switch msgType {
 	case dot.SystemMessage:
-		return NewSystemMessage(""), nil
+		return NewSystemMessage(nil), nil
 	case dot.TextMessage:
 		return NewTextMessage(""), nil
+	case dot.AckMessage:
+		return NewAckMessage(nil), nil
+	case dot.DeliveredMessage, dot.ReadMessage:
+		return NewReceiptMessage(msgType, nil), nil
+	case dot.SenderKeyDistributionMessage:
+		return NewSenderKeyDistributionMessage(dot.SenderKeyDistribution{}), nil
+	case dot.ModerationMessage:
+		return NewModerationMessage(dot.Moderation{}), nil
+	case dot.PresenceSubscribeMessage, dot.PresenceUnsubscribeMessage:
+		return NewPresenceMessage(msgType, nil), nil
+	case dot.TypingStartMessage, dot.TypingStopMessage:
+		return NewTypingMessage(msgType), nil
+	case dot.ServerAckMessage:
+		return NewServerAckMessage(dot.ServerAck{}), nil
+	case dot.HistoryMessage:
+		return NewHistoryMessage(dot.History{}), nil
+	case dot.EditMessage, dot.DeleteMessage:
+		return NewMutationMessage(msgType), nil
+	case dot.ReactionMessage:
+		return NewReactionMessage(), nil
+	case dot.ImageMessage, dot.VideoMessage, dot.FileMessage:
+		return NewAttachmentMessage(msgType), nil
 	// TODO: 在这里添加其他消息类型的处理
 	default:
 		return nil, errors.New("不支持的消息类型: " + string(msgType))
@@ -0,0 +1,34 @@
+package message_type
+
+import (
+	"errors"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+)
+
+// ModerationMessage 代表客户端发起的房间管理命令，只由客户端发送给服务端。
+type ModerationMessage struct {
+	BaseMessage[dot.Moderation]
+	Moderation dot.Moderation `json:"moderation"`
+}
+
+// NewModerationMessage 创建并返回一个新的 ModerationMessage 实例。
+func NewModerationMessage(moderation dot.Moderation) *ModerationMessage {
+	msg := &ModerationMessage{Moderation: moderation}
+	msg.MessageType = dot.ModerationMessage
+	msg.BaseMessage.child = msg
+	return msg
+}
+
+// LoadFromEnvelope 从给定的 dot.Envelope 中加载数据到 ModerationMessage。
+func (m *ModerationMessage) LoadFromEnvelope(env dot.Envelope) error {
+	moderation := env.Message.Content.Moderation
+	if moderation == nil || moderation.Action == "" || moderation.Target == "" {
+		return errors.New("moderation message requires action and target")
+	}
+	if env.Destination == "" || env.Destination == "all" {
+		return errors.New("moderation message requires a room destination")
+	}
+	m.Moderation = *moderation
+	return nil
+}
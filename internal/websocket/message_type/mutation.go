@@ -0,0 +1,41 @@
+package message_type
+
+import (
+	"errors"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+)
+
+// MutationMessage 代表对房间内已发送消息的编辑或撤回，类型为 edit 或 delete。
+// 被引用的消息由 Content.Ref 指定，编辑后的新内容放在 Content 的其余字段中。
+type MutationMessage struct {
+	BaseMessage[struct{}]
+	MessageId string      // 被编辑或撤回的服务端消息 ID
+	Content   dot.Content // edit 时的新内容，不含 Ref
+}
+
+// NewMutationMessage 创建并返回一个新的 MutationMessage 实例，msgType 只能是 edit 或 delete。
+func NewMutationMessage(msgType dot.MessageType) *MutationMessage {
+	msg := &MutationMessage{}
+	msg.MessageType = msgType
+	msg.BaseMessage.child = msg
+	return msg
+}
+
+// LoadFromEnvelope 从给定的 dot.Envelope 中加载数据到 MutationMessage。
+func (m *MutationMessage) LoadFromEnvelope(env dot.Envelope) error {
+	if env.Destination == "" || env.Destination == "all" {
+		return errors.New("edit/delete message requires a room destination")
+	}
+	ref := env.Message.Content.Ref
+	if ref == nil || ref.MessageId == "" {
+		return errors.New("edit/delete message requires a referenced messageId")
+	}
+	if m.MessageType == dot.EditMessage && env.Message.Content.Text == "" && env.Message.Content.Attachment == nil {
+		return errors.New("edit message requires new content")
+	}
+	m.MessageId = ref.MessageId
+	m.Content = env.Message.Content
+	m.Content.Ref = nil
+	return nil
+}
@@ -0,0 +1,30 @@
+package message_type
+
+import (
+	"errors"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+)
+
+// PresenceMessage 代表在线状态的订阅或取消订阅请求，只由客户端发送给服务端。
+type PresenceMessage struct {
+	BaseMessage[[]string]
+	Users []string `json:"users"` // 订阅或取消订阅的用户 UID
+}
+
+// NewPresenceMessage 创建并返回一个新的 PresenceMessage 实例，msgType 只能是 presence_subscribe 或 presence_unsubscribe。
+func NewPresenceMessage(msgType dot.MessageType, users []string) *PresenceMessage {
+	msg := &PresenceMessage{Users: users}
+	msg.MessageType = msgType
+	msg.BaseMessage.child = msg
+	return msg
+}
+
+// LoadFromEnvelope 从给定的 dot.Envelope 中加载数据到 PresenceMessage。
+func (p *PresenceMessage) LoadFromEnvelope(env dot.Envelope) error {
+	if env.Message.Content.Presence == nil || len(env.Message.Content.Presence.Users) == 0 {
+		return errors.New("presence message requires at least one user")
+	}
+	p.Users = env.Message.Content.Presence.Users
+	return nil
+}
@@ -0,0 +1,40 @@
+package message_type
+
+import (
+	"errors"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+)
+
+// maxReactionLength 表情负载的最大长度，与数据库列宽一致
+const maxReactionLength = 256
+
+// ReactionMessage 代表对房间消息添加或取消的表情回应。
+type ReactionMessage struct {
+	BaseMessage[dot.Reaction]
+	Reaction dot.Reaction `json:"reaction"`
+}
+
+// NewReactionMessage 创建并返回一个新的 ReactionMessage 实例。
+func NewReactionMessage() *ReactionMessage {
+	msg := &ReactionMessage{}
+	msg.MessageType = dot.ReactionMessage
+	msg.BaseMessage.child = msg
+	return msg
+}
+
+// LoadFromEnvelope 从给定的 dot.Envelope 中加载数据到 ReactionMessage。
+func (r *ReactionMessage) LoadFromEnvelope(env dot.Envelope) error {
+	if env.Destination == "" || env.Destination == "all" {
+		return errors.New("reaction message requires a room destination")
+	}
+	reaction := env.Message.Content.Reaction
+	if reaction == nil || reaction.MessageId == "" {
+		return errors.New("reaction message requires a referenced messageId")
+	}
+	if reaction.Emoji == "" || len(reaction.Emoji) > maxReactionLength {
+		return errors.New("invalid reaction emoji")
+	}
+	r.Reaction = *reaction
+	return nil
+}
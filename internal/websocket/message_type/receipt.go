@@ -0,0 +1,64 @@
+package message_type
+
+import (
+	"errors"
+	"time"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+)
+
+// ReceiptEnvelopeArgs 定义了构建回执 Envelope 所需的参数结构。
+type ReceiptEnvelopeArgs struct {
+	SenderUid   string          // 产生回执的接收者 UID
+	SenderName  string          // 产生回执的接收者名称
+	Destination string          // 消息所在房间
+	ReadStatus  *dot.ReadStatus // 该消息在房间内的已读情况
+}
+
+// ReceiptMessage 代表送达或已读回执。
+type ReceiptMessage struct {
+	BaseMessage[[]string]
+	MessageIds []string `json:"messageIds"` // 回执引用的服务端消息 ID
+}
+
+// NewReceiptMessage 创建并返回一个新的 ReceiptMessage 实例，msgType 只能是 delivered 或 read。
+func NewReceiptMessage(msgType dot.MessageType, messageIds []string) *ReceiptMessage {
+	msg := &ReceiptMessage{MessageIds: messageIds}
+	msg.MessageType = msgType
+	msg.BaseMessage.child = msg
+	return msg
+}
+
+// StructureMessage 根据回执数据构建转发给原发送者的 dot.Envelope。
+// args 可选传入一个 ReceiptEnvelopeArgs。
+func (r *ReceiptMessage) StructureMessage(args ...any) *dot.Envelope {
+	var opt ReceiptEnvelopeArgs
+	if len(args) == 1 {
+		opt, _ = args[0].(ReceiptEnvelopeArgs)
+	}
+
+	return &dot.Envelope{
+		Source: dot.Source{
+			Uid:  opt.SenderUid,
+			Name: opt.SenderName,
+		},
+		Message: dot.DataMessage{
+			Type: r.MessageType,
+			Content: dot.Content{
+				Receipt: &dot.Receipt{MessageIds: r.MessageIds},
+			},
+		},
+		ReadStatus:  opt.ReadStatus,
+		Destination: opt.Destination,
+		Timestamp:   time.Now(),
+	}
+}
+
+// LoadFromEnvelope 从给定的 dot.Envelope 中加载数据到 ReceiptMessage。
+func (r *ReceiptMessage) LoadFromEnvelope(env dot.Envelope) error {
+	if env.Message.Content.Receipt == nil || len(env.Message.Content.Receipt.MessageIds) == 0 {
+		return errors.New("receipt message requires at least one messageId")
+	}
+	r.MessageIds = env.Message.Content.Receipt.MessageIds
+	return nil
+}
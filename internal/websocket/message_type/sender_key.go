@@ -0,0 +1,38 @@
+package message_type
+
+import (
+	"errors"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+)
+
+// SenderKeyDistributionMessage 代表发给房间内单个成员的 Sender Key 分发消息。
+// 分发内容由客户端成对加密放在 Content.Text 中，服务端只负责路由与记录分发状态。
+type SenderKeyDistributionMessage struct {
+	BaseMessage[dot.SenderKeyDistribution]
+	Distribution dot.SenderKeyDistribution `json:"senderKey"`
+}
+
+// NewSenderKeyDistributionMessage 创建并返回一个新的 SenderKeyDistributionMessage 实例。
+func NewSenderKeyDistributionMessage(distribution dot.SenderKeyDistribution) *SenderKeyDistributionMessage {
+	msg := &SenderKeyDistributionMessage{Distribution: distribution}
+	msg.MessageType = dot.SenderKeyDistributionMessage
+	msg.BaseMessage.child = msg
+	return msg
+}
+
+// LoadFromEnvelope 从给定的 dot.Envelope 中加载数据到 SenderKeyDistributionMessage。
+func (s *SenderKeyDistributionMessage) LoadFromEnvelope(env dot.Envelope) error {
+	distribution := env.Message.Content.SenderKey
+	if distribution == nil || distribution.Recipient == "" || distribution.DistributionId == "" {
+		return errors.New("sender key distribution requires recipient and distributionId")
+	}
+	if distribution.Generation < 0 {
+		return errors.New("sender key generation must not be negative")
+	}
+	if env.Message.Content.Text == "" {
+		return errors.New("sender key distribution requires encrypted content")
+	}
+	s.Distribution = *distribution
+	return nil
+}
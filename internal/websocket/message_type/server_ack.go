@@ -0,0 +1,52 @@
+package message_type
+
+import (
+	"errors"
+	"time"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+)
+
+// ServerAckMessage 代表服务端对客户端消息的受理回执，只由服务端发送给发送连接。
+type ServerAckMessage struct {
+	BaseMessage[dot.ServerAck]
+	Ack dot.ServerAck `json:"serverAck"`
+}
+
+// NewServerAckMessage 创建并返回一个新的 ServerAckMessage 实例。
+func NewServerAckMessage(ack dot.ServerAck) *ServerAckMessage {
+	msg := &ServerAckMessage{Ack: ack}
+	msg.MessageType = dot.ServerAckMessage
+	msg.BaseMessage.child = msg
+	return msg
+}
+
+// StructureMessage 根据受理结果构建回复给发送连接的 dot.Envelope。
+// args 可选传入消息所在房间的 UUID。
+func (s *ServerAckMessage) StructureMessage(args ...any) *dot.Envelope {
+	var destination string
+	if len(args) == 1 {
+		destination, _ = args[0].(string)
+	}
+
+	ack := s.Ack
+	return &dot.Envelope{
+		Source: dot.Source{
+			Uid:  "system",
+			Name: "System",
+		},
+		Message: dot.DataMessage{
+			Type: dot.ServerAckMessage,
+			Content: dot.Content{
+				ServerAck: &ack,
+			},
+		},
+		Destination: destination,
+		Timestamp:   time.Now(),
+	}
+}
+
+// LoadFromEnvelope server_ack 只能由服务端发出，客户端发送的一律拒绝。
+func (s *ServerAckMessage) LoadFromEnvelope(env dot.Envelope) error {
+	return errors.New("server_ack can only be sent by the server")
+}
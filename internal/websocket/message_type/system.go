@@ -1,26 +1,27 @@
 package message_type
 
 import (
+	"errors"
 	"time"
 
 	"qianmianyao/MistChat-Server/internal/models/dot"
 )
 
-// SystemMessage 代表系统生成的消息。
+// SystemMessage 代表系统生成的消息，携带结构化的系统事件。
 type SystemMessage struct {
-	BaseMessage[string]     // 嵌入基础消息结构
-	Data                any `json:"data"` // 系统消息携带的具体数据
+	BaseMessage[dot.SystemEvent]                 // 嵌入基础消息结构
+	Event                        dot.SystemEvent `json:"data"` // 系统消息携带的事件
 }
 
 // NewSystemMessage 创建并返回一个新的 SystemMessage 实例。
-func NewSystemMessage(data any) *SystemMessage {
-	msg := &SystemMessage{Data: data}
+func NewSystemMessage(event dot.SystemEvent) *SystemMessage {
+	msg := &SystemMessage{Event: event}
 	msg.MessageType = dot.SystemMessage
 	msg.BaseMessage.child = msg
 	return msg
 }
 
-// StructureMessage 根据 SystemMessage 的数据构建一个 dot.Envelope 结构。
+// StructureMessage 根据 SystemMessage 的事件构建一个 dot.Envelope 结构。
 func (sm *SystemMessage) StructureMessage(args ...any) *dot.Envelope {
 	return &dot.Envelope{
 		Source: dot.Source{
@@ -30,7 +31,7 @@ func (sm *SystemMessage) StructureMessage(args ...any) *dot.Envelope {
 		Message: dot.DataMessage{
 			Type: dot.SystemMessage,
 			Content: dot.Content{
-				Data: sm.Data,
+				Data: sm.Event,
 			},
 		},
 		Destination: "all",
@@ -38,8 +39,7 @@ func (sm *SystemMessage) StructureMessage(args ...any) *dot.Envelope {
 	}
 }
 
-// LoadFromEnvelope 从给定的 dot.Envelope 中加载数据到 SystemMessage。
+// LoadFromEnvelope 系统消息只能由服务端发出，客户端发送的系统消息一律拒绝。
 func (sm *SystemMessage) LoadFromEnvelope(env dot.Envelope) error {
-	sm.Data = env.Message.Content.Text
-	return nil
+	return errors.New("system messages can only be sent by the server")
 }
@@ -0,0 +1,57 @@
+package message_type
+
+import (
+	"errors"
+	"time"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+)
+
+// TypingEnvelopeArgs 定义了构建输入状态 Envelope 所需的参数结构。
+type TypingEnvelopeArgs struct {
+	SenderUid   string // 正在输入的用户 UID
+	SenderName  string // 正在输入的用户名称
+	Destination string // 所在房间
+}
+
+// TypingMessage 代表输入状态，类型为 typing_start 或 typing_stop。
+type TypingMessage struct {
+	BaseMessage[struct{}]
+}
+
+// NewTypingMessage 创建并返回一个新的 TypingMessage 实例，msgType 只能是 typing_start 或 typing_stop。
+func NewTypingMessage(msgType dot.MessageType) *TypingMessage {
+	msg := &TypingMessage{}
+	msg.MessageType = msgType
+	msg.BaseMessage.child = msg
+	return msg
+}
+
+// StructureMessage 构建转发给房间成员的输入状态 dot.Envelope。
+// args 可选传入一个 TypingEnvelopeArgs。
+func (t *TypingMessage) StructureMessage(args ...any) *dot.Envelope {
+	var opt TypingEnvelopeArgs
+	if len(args) == 1 {
+		opt, _ = args[0].(TypingEnvelopeArgs)
+	}
+
+	return &dot.Envelope{
+		Source: dot.Source{
+			Uid:  opt.SenderUid,
+			Name: opt.SenderName,
+		},
+		Message: dot.DataMessage{
+			Type: t.MessageType,
+		},
+		Destination: opt.Destination,
+		Timestamp:   time.Now(),
+	}
+}
+
+// LoadFromEnvelope 从给定的 dot.Envelope 中加载数据到 TypingMessage。
+func (t *TypingMessage) LoadFromEnvelope(env dot.Envelope) error {
+	if env.Destination == "" || env.Destination == "all" {
+		return errors.New("typing message requires a room destination")
+	}
+	return nil
+}
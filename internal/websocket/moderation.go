@@ -0,0 +1,68 @@
+package websocket
+
+import (
+	"fmt"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/services/chat"
+	"qianmianyao/MistChat-Server/internal/websocket/message_type"
+	"qianmianyao/MistChat-Server/pkg/global"
+)
+
+// moderationEvents 管理操作对应的系统事件
+var moderationEvents = map[chat.ModerationAction]dot.SystemEventType{
+	chat.KickMember:        dot.MemberKickedEvent,
+	chat.BanMember:         dot.MemberBannedEvent,
+	chat.UnbanMember:       dot.MemberUnbannedEvent,
+	chat.PromoteMember:     dot.MemberRoleChangedEvent,
+	chat.DemoteMember:      dot.MemberRoleChangedEvent,
+	chat.TransferOwnership: dot.MemberRoleChangedEvent,
+}
+
+// Moderate 执行房间管理操作，成功后通知房间成员与被操作者。
+// 踢出与封禁会改变房间成员，随后重置房间的 Sender Key，使被移除的成员无法解密后续消息。
+func (h *Hub) Moderate(roomUUID, operator, target string, action chat.ModerationAction, reason string) error {
+	if err := h.chatModeration.Apply(roomUUID, operator, target, action, reason); err != nil {
+		return err
+	}
+
+	members := h.chatFind.AllUsersInTheRoom(roomUUID)
+	if action.RemovesMember() {
+		members = append(members, target)
+	}
+	h.NotifyUsers(members, roomUUID, dot.RoomModerationNotice{
+		Event:    moderationEvents[action],
+		RoomUUID: roomUUID,
+		Action:   string(action),
+		Operator: operator,
+		Target:   target,
+		Reason:   reason,
+	})
+
+	if action.RemovesMember() {
+		go h.ResetSenderKeys(roomUUID)
+	}
+	return nil
+}
+
+// handleModeration 处理客户端通过 WebSocket 发起的房间管理命令，失败时向发起连接回复原因。
+func (h *Hub) handleModeration(client *Client, msg *message_type.ModerationMessage, roomUUID string) {
+	action := chat.ModerationAction(msg.Moderation.Action)
+	err := h.Moderate(roomUUID, client.uuid, msg.Moderation.Target, action, msg.Moderation.Reason)
+	if err == nil {
+		return
+	}
+
+	notice, serr := message_type.NewSystemMessage(dot.ModerationFailedNotice{
+		Event:    dot.ModerationFailedEvent,
+		RoomUUID: roomUUID,
+		Action:   msg.Moderation.Action,
+		Target:   msg.Moderation.Target,
+		Error:    err.Error(),
+	}).SerializeWithArgs()
+	if serr != nil {
+		global.Logger.Error(fmt.Sprintf("Failed to serialize moderation failure for %s: %v", client.uuid, serr))
+		return
+	}
+	h.SendToDevice(client.uuid, client.deviceId, notice)
+}
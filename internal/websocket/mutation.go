@@ -0,0 +1,101 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/services/chat"
+	"qianmianyao/MistChat-Server/internal/websocket/message_type"
+	"qianmianyao/MistChat-Server/pkg/global"
+)
+
+var (
+	errMessageNotFound = errors.New("message not found")
+	errNotMessageOwner = errors.New("only the original sender can edit this message")
+)
+
+// handleMutation 处理客户端对已发送消息的编辑或撤回。
+// 编辑只允许原发送者执行，撤回允许原发送者或房间管理员执行；
+// 变更写入消息历史与尚未投递的离线队列后，将请求信封转发给房间的其他成员。
+func (h *Hub) handleMutation(client *Client, msg *message_type.MutationMessage, envelope dot.Envelope, message []byte) {
+	roomUUID := envelope.Destination
+	ack := dot.ServerAck{Nonce: envelope.Nonce, Id: msg.MessageId}
+
+	if err := h.applyMutation(client, msg, roomUUID); err != nil {
+		ack.Error = err.Error()
+		h.sendServerAck(client, roomUUID, ack)
+		return
+	}
+
+	fields := map[string]any{}
+	if msg.GetType() == dot.EditMessage {
+		fields["editedAt"] = time.Now()
+	}
+	stamped, err := setEnvelopeFields(message, fields)
+	if err != nil {
+		global.Logger.Warn(fmt.Sprintf("Failed to stamp mutation from %s: %v", client.uuid, err))
+		return
+	}
+
+	h.deliver(h.chatFind.AllUsersInTheRoom(roomUUID), roomUUID, stamped, client)
+	h.sendServerAck(client, roomUUID, ack)
+}
+
+// applyMutation 校验权限并把编辑或撤回应用到存储的消息上。
+func (h *Hub) applyMutation(client *Client, msg *message_type.MutationMessage, roomUUID string) error {
+	if err := h.canSendToRoom(client.uuid, roomUUID); err != nil {
+		return err
+	}
+
+	original, err := h.referencedMessage(roomUUID, msg.MessageId)
+	if err != nil {
+		return err
+	}
+
+	if msg.GetType() == dot.DeleteMessage {
+		if original.SenderUUID != client.uuid {
+			role, err := h.chatFind.MemberRole(client.uuid, roomUUID)
+			if err != nil || !chat.CanManageRoom(role) {
+				return chat.ErrPermissionDenied
+			}
+		}
+		attachmentIDs, err := h.chatDelete.RoomMessage(msg.MessageId)
+		if err != nil {
+			return errors.New("internal error")
+		}
+		h.DeleteAttachmentContent(attachmentIDs)
+		return nil
+	}
+
+	if original.SenderUUID != client.uuid {
+		return errNotMessageOwner
+	}
+	var previous dot.Envelope
+	if err := json.Unmarshal([]byte(original.Envelope), &previous); err != nil {
+		global.Logger.Warn(fmt.Sprintf("Failed to parse stored message %s: %v", msg.MessageId, err))
+		return errors.New("internal error")
+	}
+	if err := h.checkAttachment(roomUUID, previous.Message.Type, msg.Content.Attachment); err != nil {
+		return err
+	}
+	edited, err := editedEnvelope([]byte(original.Envelope), previous.Message.Type, msg.Content)
+	if err != nil {
+		global.Logger.Warn(fmt.Sprintf("Failed to rebuild edited message %s: %v", msg.MessageId, err))
+		return errors.New("internal error")
+	}
+	if err := h.chatUpdate.RoomMessageEnvelope(msg.MessageId, edited); err != nil {
+		return errors.New("internal error")
+	}
+	return nil
+}
+
+// editedEnvelope 以新内容替换原信封中的消息体并记录编辑时间，保留消息类型、ID、序号与发送者等其余字段。
+func editedEnvelope(original []byte, msgType dot.MessageType, content dot.Content) ([]byte, error) {
+	return setEnvelopeFields(original, map[string]any{
+		"message":  dot.DataMessage{Type: msgType, Content: content},
+		"editedAt": time.Now(),
+	})
+}
@@ -0,0 +1,51 @@
+package websocket
+
+import (
+	"fmt"
+	"slices"
+
+	"qianmianyao/MistChat-Server/pkg/global"
+)
+
+// offlineFlushBatchSize 是每次向客户端补发的离线消息上限，其余消息在客户端确认后继续补发。
+const offlineFlushBatchSize = 100
+
+// flushOfflineMessages 按写入顺序向客户端补发尚未投递的离线消息。
+// 每条消息附带 queueId，只有在客户端 ack 后才会从队列中删除。
+func (h *Hub) flushOfflineMessages(client *Client) {
+	client.offlineMu.Lock()
+	defer client.offlineMu.Unlock()
+
+	offlineMessages, err := h.chatFind.OfflineMessages(client.uuid, client.deviceId, client.offlineCursor, offlineFlushBatchSize)
+	if err != nil {
+		return
+	}
+
+	for _, offlineMessage := range offlineMessages {
+		message, err := setEnvelopeFields([]byte(offlineMessage.Envelope), map[string]any{"queueId": offlineMessage.ID})
+		if err != nil {
+			global.Logger.Warn(fmt.Sprintf("离线消息 %d 格式错误: %v", offlineMessage.ID, err))
+			continue
+		}
+		if !client.trySend(message) {
+			// 发送缓冲已满或连接已注销，剩余消息等待下一次 ack 或重新连接后再补发。
+			return
+		}
+		client.offlineCursor = offlineMessage.ID
+	}
+}
+
+// acknowledgeOfflineMessages 删除客户端已确认的离线消息，并继续补发剩余消息。
+func (h *Hub) acknowledgeOfflineMessages(client *Client, queueIds []uint) {
+	if err := h.chatDelete.OfflineMessages(client.uuid, client.deviceId, queueIds); err != nil {
+		return
+	}
+
+	client.offlineMu.Lock()
+	drained := client.offlineCursor <= slices.Max(queueIds)
+	client.offlineMu.Unlock()
+
+	if drained {
+		h.flushOfflineMessages(client)
+	}
+}
@@ -0,0 +1,36 @@
+package websocket
+
+import (
+	"fmt"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/websocket/message_type"
+	"qianmianyao/MistChat-Server/pkg/config"
+	"qianmianyao/MistChat-Server/pkg/global"
+)
+
+// CheckPreKeyPool 检查设备剩余的一次性预密钥数量，低于阈值时推送系统通知提醒客户端补充。
+// 只通知在线设备，不写入离线队列：设备上线时会再次检查，避免每次取用密钥都为离线设备堆积一条通知。
+func (h *Hub) CheckPreKeyPool(uuid string, deviceId int) {
+	client, online := h.GetClient(uuid, deviceId)
+	if !online {
+		return
+	}
+	threshold := config.GetConfig().Signal.PreKeyLowThreshold
+	remaining, err := h.chatFind.UnusedSignalPreKeyCount(uuid, deviceId)
+	if err != nil || remaining >= threshold {
+		return
+	}
+
+	notice, err := message_type.NewSystemMessage(dot.PreKeyLowNotice{
+		Event:     dot.PreKeyLowEvent,
+		DeviceId:  deviceId,
+		Remaining: remaining,
+		Threshold: threshold,
+	}).SerializeWithArgs()
+	if err != nil {
+		global.Logger.Error(fmt.Sprintf("Failed to serialize prekey notice for %s/%d: %v", uuid, deviceId, err))
+		return
+	}
+	h.sendToClients([]*Client{client}, notice)
+}
@@ -0,0 +1,192 @@
+package websocket
+
+import (
+	"fmt"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/websocket/message_type"
+	"qianmianyao/MistChat-Server/pkg/global"
+)
+
+// maxPresenceSubscriptions 单个连接最多可订阅的用户数
+const maxPresenceSubscriptions = 500
+
+// handlePresence 处理连接对同房间用户在线状态的订阅与取消订阅。
+// 只能订阅与自己共享至少一个房间的用户；订阅成功后立即回复这些用户的当前状态。
+func (h *Hub) handlePresence(client *Client, msg *message_type.PresenceMessage) {
+	if msg.GetType() == dot.PresenceUnsubscribeMessage {
+		h.unsubscribePresence(client, msg.Users)
+		return
+	}
+
+	peers, err := h.chatFind.RoomPeers(client.uuid)
+	if err != nil {
+		return
+	}
+	isPeer := make(map[string]bool, len(peers))
+	for _, peer := range peers {
+		isPeer[peer] = true
+	}
+	var users []string
+	for _, uid := range msg.Users {
+		if isPeer[uid] {
+			users = append(users, uid)
+		}
+	}
+	users = h.subscribePresence(client, users)
+	if len(users) == 0 {
+		return
+	}
+
+	// 回复当前状态快照
+	snapshot, err := h.chatFind.ChatUsersByUUIDs(users)
+	if err != nil {
+		return
+	}
+	for _, user := range snapshot {
+		notice := dot.PresenceNotice{Event: dot.UserOfflineEvent, UUID: user.UUID}
+		if !user.HidePresence {
+			if h.IsOnline(user.UUID) {
+				notice.Event = dot.UserOnlineEvent
+			} else {
+				notice.LastSeenAt = user.LastSeenAt
+			}
+		}
+		message, err := message_type.NewSystemMessage(notice).SerializeWithArgs()
+		if err != nil {
+			global.Logger.Error(fmt.Sprintf("Failed to serialize presence snapshot for %s: %v", user.UUID, err))
+			continue
+		}
+		h.sendToClients([]*Client{client}, message)
+	}
+}
+
+// subscribePresence 为连接登记订阅，返回实际新增的订阅；超出上限的部分被忽略。
+func (h *Hub) subscribePresence(client *Client, users []string) []string {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	var added []string
+	for _, uid := range users {
+		if client.presenceSubscriptions[uid] {
+			continue
+		}
+		if len(client.presenceSubscriptions) >= maxPresenceSubscriptions {
+			break
+		}
+		client.presenceSubscriptions[uid] = true
+		if h.presenceSubscribers[uid] == nil {
+			h.presenceSubscribers[uid] = make(map[*Client]bool)
+		}
+		h.presenceSubscribers[uid][client] = true
+		added = append(added, uid)
+	}
+	return added
+}
+
+// unsubscribePresence 取消连接对指定用户的订阅。
+func (h *Hub) unsubscribePresence(client *Client, users []string) {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	for _, uid := range users {
+		delete(client.presenceSubscriptions, uid)
+		delete(h.presenceSubscribers[uid], client)
+		if len(h.presenceSubscribers[uid]) == 0 {
+			delete(h.presenceSubscribers, uid)
+		}
+	}
+}
+
+// unsubscribeAllPresence 连接断开时清除其全部订阅。
+func (h *Hub) unsubscribeAllPresence(client *Client) {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	for uid := range client.presenceSubscriptions {
+		delete(h.presenceSubscribers[uid], client)
+		if len(h.presenceSubscribers[uid]) == 0 {
+			delete(h.presenceSubscribers, uid)
+		}
+	}
+	client.presenceSubscriptions = make(map[string]bool)
+}
+
+// broadcastPresence 通知订阅者该用户已上线或离线，隐藏在线状态的用户不推送。
+// 在线状态只对当前连接有意义，因此只推送给在线的订阅连接，不写入离线队列。
+func (h *Hub) broadcastPresence(uuid string, online bool) {
+	user, err := h.chatFind.ChatUserByUUID(uuid)
+	if err != nil || user.HidePresence {
+		return
+	}
+
+	notice := dot.PresenceNotice{Event: dot.UserOnlineEvent, UUID: uuid}
+	if !online {
+		notice.Event = dot.UserOfflineEvent
+		notice.LastSeenAt = user.LastSeenAt
+	}
+	h.notifyPresence(uuid, notice)
+}
+
+// PresenceVisibilityChanged 在用户修改在线状态隐私设置后通知订阅者：
+// 隐藏时推送不带最近在线时间的离线状态，取消隐藏时推送当前真实状态。
+func (h *Hub) PresenceVisibilityChanged(uuid string, hidden bool) {
+	if hidden {
+		h.notifyPresence(uuid, dot.PresenceNotice{Event: dot.UserOfflineEvent, UUID: uuid})
+		return
+	}
+	h.broadcastPresence(uuid, h.IsOnline(uuid))
+}
+
+// notifyPresence 将在线状态通知推送给订阅了该用户的所有连接。
+// 推送前重新核对同房间关系，订阅者因退出、被移除或封禁而不再与该用户共享房间时，撤销其订阅且不推送。
+func (h *Hub) notifyPresence(uuid string, notice dot.PresenceNotice) {
+	h.presenceMu.Lock()
+	subscribers := make([]*Client, 0, len(h.presenceSubscribers[uuid]))
+	for client := range h.presenceSubscribers[uuid] {
+		subscribers = append(subscribers, client)
+	}
+	h.presenceMu.Unlock()
+	if len(subscribers) == 0 {
+		return
+	}
+
+	peers, err := h.chatFind.RoomPeers(uuid)
+	if err != nil {
+		return
+	}
+	isPeer := make(map[string]bool, len(peers))
+	for _, peer := range peers {
+		isPeer[peer] = true
+	}
+	allowed := subscribers[:0]
+	for _, client := range subscribers {
+		if isPeer[client.uuid] {
+			allowed = append(allowed, client)
+			continue
+		}
+		h.unsubscribePresence(client, []string{uuid})
+	}
+	subscribers = allowed
+	if len(subscribers) == 0 {
+		return
+	}
+
+	message, err := message_type.NewSystemMessage(notice).SerializeWithArgs()
+	if err != nil {
+		global.Logger.Error(fmt.Sprintf("Failed to serialize presence notice for %s: %v", uuid, err))
+		return
+	}
+	h.sendToClients(subscribers, message)
+}
+
+// sendToClients 将消息直接写入连接的发送通道，发送缓冲已满的连接被注销，已注销的连接被跳过。
+func (h *Hub) sendToClients(clients []*Client, message []byte) {
+	for _, client := range clients {
+		if !client.trySend(message) {
+			go func(c *Client) {
+				h.unregister <- c
+			}(client)
+		}
+	}
+}
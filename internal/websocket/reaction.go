@@ -0,0 +1,58 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/websocket/message_type"
+	"qianmianyao/MistChat-Server/pkg/global"
+)
+
+// handleReaction 处理客户端对房间消息的表情回应。
+// 同一用户对同一消息的同一表情只计一次，只有记录确实发生变化时才将请求信封转发给房间的其他成员；
+// 重复添加或取消不存在的回应只回复 server_ack。
+func (h *Hub) handleReaction(client *Client, msg *message_type.ReactionMessage, envelope dot.Envelope, message []byte) {
+	roomUUID := envelope.Destination
+	ack := dot.ServerAck{Nonce: envelope.Nonce, Id: msg.Reaction.MessageId}
+
+	changed, err := h.applyReaction(client, msg.Reaction, roomUUID)
+	if err != nil {
+		ack.Error = err.Error()
+		h.sendServerAck(client, roomUUID, ack)
+		return
+	}
+	if !changed {
+		h.sendServerAck(client, roomUUID, ack)
+		return
+	}
+
+	stripped, err := setEnvelopeFields(message, nil)
+	if err != nil {
+		global.Logger.Warn(fmt.Sprintf("Failed to strip reaction from %s: %v", client.uuid, err))
+		return
+	}
+	h.deliver(h.chatFind.AllUsersInTheRoom(roomUUID), roomUUID, stripped, client)
+	h.sendServerAck(client, roomUUID, ack)
+}
+
+// applyReaction 校验目标消息属于该房间后添加或取消表情回应，changed 表示回应记录是否发生变化。
+func (h *Hub) applyReaction(client *Client, reaction dot.Reaction, roomUUID string) (changed bool, err error) {
+	if err := h.canSendToRoom(client.uuid, roomUUID); err != nil {
+		return false, err
+	}
+
+	if _, err := h.referencedMessage(roomUUID, reaction.MessageId); err != nil {
+		return false, err
+	}
+
+	if reaction.Remove {
+		changed, err = h.chatDelete.MessageReaction(reaction.MessageId, client.uuid, reaction.Emoji)
+	} else {
+		changed, err = h.chatCreate.MessageReaction(reaction.MessageId, roomUUID, client.uuid, reaction.Emoji)
+	}
+	if err != nil {
+		return false, errors.New("internal error")
+	}
+	return changed, nil
+}
@@ -0,0 +1,61 @@
+package websocket
+
+import (
+	"fmt"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/websocket/message_type"
+	"qianmianyao/MistChat-Server/pkg/global"
+)
+
+// handleReceipt 持久化接收者的送达/已读回执，并逐条转发给原发送者。
+// 转发的信封中附带该消息在房间内的 ReadStatus，便于客户端渲染已读状态。
+func (h *Hub) handleReceipt(client *Client, receipt *message_type.ReceiptMessage) {
+	var err error
+	switch receipt.GetType() {
+	case dot.DeliveredMessage:
+		err = h.chatUpdate.MarkDelivered(client.uuid, receipt.MessageIds)
+	case dot.ReadMessage:
+		err = h.chatUpdate.MarkRead(client.uuid, receipt.MessageIds)
+	}
+	if err != nil {
+		return
+	}
+
+	for _, messageID := range receipt.MessageIds {
+		receipts, err := h.chatFind.MessageReceipts(messageID)
+		if err != nil || len(receipts) == 0 {
+			continue
+		}
+
+		readStatus := &dot.ReadStatus{ReadBy: []string{}, UnreadBy: []string{}}
+		isRecipient := false
+		for _, r := range receipts {
+			if r.RecipientUUID == client.uuid {
+				isRecipient = true
+			}
+			if r.ReadAt != nil {
+				readStatus.ReadBy = append(readStatus.ReadBy, r.RecipientUUID)
+			} else {
+				readStatus.UnreadBy = append(readStatus.UnreadBy, r.RecipientUUID)
+			}
+		}
+		// 只允许消息的接收者为其发出回执。
+		if !isRecipient {
+			global.Logger.Debug(fmt.Sprintf("用户 %s 不是消息 %s 的接收者", client.uuid, messageID))
+			continue
+		}
+
+		forward, err := message_type.NewReceiptMessage(receipt.GetType(), []string{messageID}).SerializeWithArgs(message_type.ReceiptEnvelopeArgs{
+			SenderUid:   client.uuid,
+			SenderName:  client.username,
+			Destination: receipts[0].RoomUUID,
+			ReadStatus:  readStatus,
+		})
+		if err != nil {
+			global.Logger.Error(fmt.Sprintf("Failed to serialize receipt for %s: %v", messageID, err))
+			continue
+		}
+		h.SendToUser(receipts[0].SenderUUID, receipts[0].RoomUUID, forward)
+	}
+}
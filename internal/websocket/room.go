@@ -0,0 +1,25 @@
+package websocket
+
+import (
+	"fmt"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/websocket/message_type"
+	"qianmianyao/MistChat-Server/pkg/global"
+)
+
+// NotifyUsers 将系统通知推送给指定用户的所有设备，不在线的设备暂存为离线消息。
+// 用于房间成员已被移除、无法再通过房间成员列表找到的场景。
+func (h *Hub) NotifyUsers(users []string, roomUUID string, notice dot.SystemEvent) {
+	message, err := message_type.NewSystemMessage(notice).SerializeWithArgs()
+	if err != nil {
+		global.Logger.Error(fmt.Sprintf("Failed to serialize room notice for %s: %v", roomUUID, err))
+		return
+	}
+	h.deliver(users, roomUUID, message, nil)
+}
+
+// NotifyRoom 将系统通知推送给房间当前的所有成员。
+func (h *Hub) NotifyRoom(roomUUID string, notice dot.SystemEvent) {
+	h.NotifyUsers(h.chatFind.AllUsersInTheRoom(roomUUID), roomUUID, notice)
+}
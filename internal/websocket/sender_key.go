@@ -0,0 +1,65 @@
+package websocket
+
+import (
+	"fmt"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/models/entity"
+	"qianmianyao/MistChat-Server/internal/services/chat"
+	"qianmianyao/MistChat-Server/internal/websocket/message_type"
+	"qianmianyao/MistChat-Server/pkg/global"
+)
+
+// routeSenderKeyDistribution 将 Sender Key 分发消息路由给房间内指定成员的指定设备，并记录该设备已收到的代数。
+// 分发消息按设备成对加密，其他设备无法解密，因此只投递给目标设备。
+// 发送者与接收者都必须是该房间的成员，目标设备必须已登记。
+func (h *Hub) routeSenderKeyDistribution(client *Client, msg *message_type.SenderKeyDistributionMessage, roomUUID string, message []byte) {
+	recipient := msg.Distribution.Recipient
+	deviceId := msg.Distribution.RecipientDeviceId
+	if deviceId == 0 {
+		deviceId = dot.DefaultDeviceId
+	}
+	if recipient == client.uuid ||
+		h.chatFind.IsTheUserIsInTheRoom(client.uuid, roomUUID) == chat.NotInRoom ||
+		h.chatFind.IsTheUserIsInTheRoom(recipient, roomUUID) == chat.NotInRoom ||
+		!h.chatFind.IsDeviceExist(recipient, deviceId) {
+		global.Logger.Debug(fmt.Sprintf("拒绝用户 %s 在房间 %s 内向 %s/%d 分发 Sender Key", client.uuid, roomUUID, recipient, deviceId))
+		return
+	}
+
+	stripped, err := setEnvelopeFields(message, nil)
+	if err != nil {
+		global.Logger.Warn(fmt.Sprintf("Failed to strip sender key distribution from %s: %v", client.uuid, err))
+		return
+	}
+	h.sendToDeviceInRoom(recipient, deviceId, roomUUID, stripped)
+
+	if err := h.chatCreate.SenderKeyDistribution(entity.SenderKeyDistribution{
+		RoomUUID:          roomUUID,
+		SenderUUID:        client.uuid,
+		RecipientUUID:     recipient,
+		RecipientDeviceID: deviceId,
+		DistributionID:    msg.Distribution.DistributionId,
+		Generation:        msg.Distribution.Generation,
+	}); err != nil {
+		global.Logger.Warn(fmt.Sprintf("Sender Key 分发记录失败: %s -> %s/%d", client.uuid, recipient, deviceId))
+	}
+}
+
+// ResetSenderKeys 在房间成员变动后清除分发记录，并通知所有成员重新生成并分发 Sender Key，
+// 以保证离开的成员无法解密后续消息、新成员可以解密。
+func (h *Hub) ResetSenderKeys(roomUUID string) {
+	if err := h.chatDelete.SenderKeyDistributions(roomUUID); err != nil {
+		return
+	}
+
+	notice, err := message_type.NewSystemMessage(dot.SenderKeyResetNotice{
+		Event:    dot.SenderKeyResetEvent,
+		RoomUUID: roomUUID,
+	}).SerializeWithArgs()
+	if err != nil {
+		global.Logger.Error(fmt.Sprintf("Failed to serialize sender key reset for %s: %v", roomUUID, err))
+		return
+	}
+	h.deliver(h.chatFind.AllUsersInTheRoom(roomUUID), roomUUID, notice, nil)
+}
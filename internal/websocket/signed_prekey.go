@@ -0,0 +1,61 @@
+package websocket
+
+import (
+	"fmt"
+	"time"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/websocket/message_type"
+	"qianmianyao/MistChat-Server/pkg/config"
+	"qianmianyao/MistChat-Server/pkg/global"
+)
+
+// defaultSignedPreKeyCheckInterval 配置的检查间隔无效时使用的间隔，与默认配置一致
+const defaultSignedPreKeyCheckInterval = time.Hour
+
+// RunSignedPreKeyMonitor 定期停用宽限期已过的旧签名预密钥，并提醒当前密钥即将到期的设备轮换。
+func (h *Hub) RunSignedPreKeyMonitor() {
+	interval := config.GetConfig().Signal.SignedPreKeyCheckInterval
+	if interval <= 0 {
+		global.Logger.Warn(fmt.Sprintf("signed_prekey_check_interval 配置无效 (%v)，使用默认值 %v", interval, defaultSignedPreKeyCheckInterval))
+		interval = defaultSignedPreKeyCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		h.checkSignedPreKeys()
+		<-ticker.C
+	}
+}
+
+// checkSignedPreKeys 执行一次签名预密钥的停用与到期提醒。
+func (h *Hub) checkSignedPreKeys() {
+	now := time.Now()
+
+	if deactivated, err := h.chatUpdate.DeactivateSupersededSignedPreKeys(now.Unix()); err == nil && deactivated > 0 {
+		global.Logger.Info(fmt.Sprintf("已停用 %d 条过期的签名预密钥", deactivated))
+	}
+
+	warnBefore := now.Add(config.GetConfig().Signal.SignedPreKeyExpiryWarning).Unix()
+	expiring, err := h.chatFind.ExpiringSignalSignedPreKeys(warnBefore)
+	if err != nil {
+		return
+	}
+	for _, key := range expiring {
+		notice, err := message_type.NewSystemMessage(dot.SignedPreKeyExpiringNotice{
+			Event:          dot.SignedPreKeyExpiringEvent,
+			DeviceId:       key.DeviceID,
+			SignedPreKeyId: int(key.PreKeyID),
+			ValidUntil:     key.ValidUntilTimestamp,
+		}).SerializeWithArgs()
+		if err != nil {
+			global.Logger.Error(fmt.Sprintf("Failed to serialize signed prekey notice for %s/%d: %v", key.ChatUserUUID, key.DeviceID, err))
+			continue
+		}
+		h.SendToDevice(key.ChatUserUUID, key.DeviceID, notice)
+		if err := h.chatUpdate.MarkSignedPreKeyExpiryNotified(key.ID); err != nil {
+			global.Logger.Warn(fmt.Sprintf("签名预密钥 %d 的到期提醒可能会重复发送", key.ID))
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package websocket
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/models/entity"
+)
+
+var (
+	errInvalidThreadRoot = errors.New("thread root must be a top-level message")
+	errReplyOutsideTopic = errors.New("reply target is not in the thread")
+)
+
+// checkReferences 校验信封中的 replyTo 与 threadRoot 引用的消息属于同一房间。
+// 话题根消息本身不能位于其他话题内；同时指定两者时，被回复的消息必须是根消息或同一话题内的回复。
+func (h *Hub) checkReferences(envelope dot.Envelope) error {
+	roomUUID := envelope.Destination
+	if envelope.ThreadRoot != "" {
+		root, err := h.referencedMessage(roomUUID, envelope.ThreadRoot)
+		if err != nil {
+			return err
+		}
+		if root.ThreadRoot != "" {
+			return errInvalidThreadRoot
+		}
+	}
+	if envelope.ReplyTo != "" {
+		target, err := h.referencedMessage(roomUUID, envelope.ReplyTo)
+		if err != nil {
+			return err
+		}
+		if envelope.ThreadRoot != "" && target.MessageID != envelope.ThreadRoot && target.ThreadRoot != envelope.ThreadRoot {
+			return errReplyOutsideTopic
+		}
+	}
+	return nil
+}
+
+// referencedMessage 获取房间内被引用的消息，不存在或属于其他房间时返回 errMessageNotFound。
+// 引用其他房间的消息按不存在处理，避免借他人房间的消息 ID 探测或篡改。
+func (h *Hub) referencedMessage(roomUUID, messageID string) (entity.RoomMessage, error) {
+	message, err := h.chatFind.RoomMessage(messageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return entity.RoomMessage{}, errMessageNotFound
+		}
+		return entity.RoomMessage{}, errors.New("internal error")
+	}
+	if message.RoomUUID != roomUUID {
+		return entity.RoomMessage{}, errMessageNotFound
+	}
+	return message, nil
+}
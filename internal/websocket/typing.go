@@ -0,0 +1,109 @@
+package websocket
+
+import (
+	"fmt"
+	"time"
+
+	"qianmianyao/MistChat-Server/internal/models/dot"
+	"qianmianyao/MistChat-Server/internal/services/chat"
+	"qianmianyao/MistChat-Server/internal/websocket/message_type"
+	"qianmianyao/MistChat-Server/pkg/global"
+)
+
+const (
+	// typingTimeout 收到 typing_start 后未再收到输入状态时，服务端代为发出 typing_stop 的等待时间。
+	typingTimeout = 5 * time.Second
+	// typingRate 与 typingBurst 限制单个连接每秒可发送的输入状态消息数量。
+	typingRate  = 2
+	typingBurst = 5
+)
+
+// typingKey 标识某用户在某房间内的输入状态
+type typingKey struct {
+	roomUUID string
+	uuid     string
+}
+
+// handleTyping 处理客户端的输入状态。
+// 同一用户在同一房间持续输入时只转发第一次 typing_start，后续的 typing_start 只刷新过期时间；
+// 超过 typingTimeout 未收到新的输入状态时由服务端代为转发 typing_stop。
+func (h *Hub) handleTyping(client *Client, msg *message_type.TypingMessage, roomUUID string) {
+	if !client.typingLimiter.Allow() {
+		return
+	}
+	key := typingKey{roomUUID: roomUUID, uuid: client.uuid}
+
+	if msg.GetType() == dot.TypingStopMessage {
+		if h.clearTyping(key) {
+			h.sendTyping(client.uuid, client.username, roomUUID, dot.TypingStopMessage)
+		}
+		return
+	}
+
+	h.typingMu.Lock()
+	if timer, typing := h.typing[key]; typing {
+		timer.Reset(typingTimeout)
+		h.typingMu.Unlock()
+		return
+	}
+	h.typingMu.Unlock()
+
+	if h.chatFind.IsTheUserIsInTheRoom(client.uuid, roomUUID) == chat.NotInRoom {
+		return
+	}
+
+	h.typingMu.Lock()
+	if _, typing := h.typing[key]; typing {
+		h.typingMu.Unlock()
+		return
+	}
+	h.typing[key] = time.AfterFunc(typingTimeout, func() {
+		if h.clearTyping(key) {
+			h.sendTyping(client.uuid, client.username, roomUUID, dot.TypingStopMessage)
+		}
+	})
+	h.typingMu.Unlock()
+
+	h.sendTyping(client.uuid, client.username, roomUUID, dot.TypingStartMessage)
+}
+
+// clearTyping 清除输入状态并停止过期计时，返回清除前是否处于输入状态。
+func (h *Hub) clearTyping(key typingKey) bool {
+	h.typingMu.Lock()
+	defer h.typingMu.Unlock()
+
+	timer, typing := h.typing[key]
+	if !typing {
+		return false
+	}
+	timer.Stop()
+	delete(h.typing, key)
+	return true
+}
+
+// sendTyping 将输入状态转发给房间内其他成员的在线设备，不写入离线队列。
+func (h *Hub) sendTyping(uuid, username, roomUUID string, msgType dot.MessageType) {
+	message, err := message_type.NewTypingMessage(msgType).SerializeWithArgs(message_type.TypingEnvelopeArgs{
+		SenderUid:   uuid,
+		SenderName:  username,
+		Destination: roomUUID,
+	})
+	if err != nil {
+		global.Logger.Error(fmt.Sprintf("Failed to serialize typing message for %s: %v", uuid, err))
+		return
+	}
+
+	members := h.chatFind.AllUsersInTheRoom(roomUUID)
+	var clients []*Client
+	usersClientsMu.RLock()
+	for _, member := range members {
+		if member == uuid {
+			continue
+		}
+		for _, c := range usersClients[member] {
+			clients = append(clients, c)
+		}
+	}
+	usersClientsMu.RUnlock()
+	h.sendToClients(clients, message)
+}
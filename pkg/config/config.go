@@ -1,15 +1,20 @@
 package config
 
 import (
+	"fmt"
 	"path/filepath"
 	"qianmianyao/MistChat-Server/internal/models/config"
 	"sync"
+	"time"
 
 	"qianmianyao/MistChat-Server/pkg/global"
 
 	"github.com/spf13/viper"
 )
 
+// minAuthSecretLength 令牌签名密钥的最小长度（字节）
+const minAuthSecretLength = 32
+
 var (
 	cfg  *config.Config
 	v    *viper.Viper
@@ -37,11 +42,45 @@ func InitConfig() *config.Config {
 				Caller:      true,
 				Stacktrace:  false,
 			},
+			// 默认令牌配置
+			Auth: config.AuthConfig{
+				AccessTokenTTL:  2 * time.Hour,
+				RefreshTokenTTL: 7 * 24 * time.Hour,
+			},
+			// 默认 Signal 配置
+			Signal: config.SignalConfig{
+				PreKeyLowThreshold:        10,
+				SignedPreKeyValidity:      30 * 24 * time.Hour,
+				SignedPreKeyGracePeriod:   48 * time.Hour,
+				SignedPreKeyExpiryWarning: 72 * time.Hour,
+				SignedPreKeyCheckInterval: time.Hour,
+			},
+			// 默认房间配置
+			Room: config.RoomConfig{
+				JoinFailureWindow:      15 * time.Minute,
+				JoinMaxFailuresPerUser: 5,
+				JoinMaxFailuresPerIP:   10,
+			},
+			// 默认附件存储配置
+			Storage: config.StorageConfig{
+				Backend:          "local",
+				LocalPath:        "data/attachments",
+				ChunkSize:        5 << 20,
+				MaxFileSize:      100 << 20,
+				MaxThumbnailSize: 1 << 20,
+				UserQuota:        1 << 30,
+				DownloadURLTTL:   15 * time.Minute,
+				UploadTTL:        24 * time.Hour,
+			},
 		}
 
 		if err := v.Unmarshal(cfg); err != nil {
 			panic("Unable to decode into struct: " + err.Error())
 		}
+		// 令牌与下载链接均以该密钥签名，空密钥或短密钥会让签名形同虚设
+		if len(cfg.Auth.Secret) < minAuthSecretLength {
+			panic(fmt.Sprintf("auth.secret must be at least %d bytes", minAuthSecretLength))
+		}
 
 		// 设置全局配置变量
 		global.Config = v
@@ -3,6 +3,7 @@ package database
 import (
 	"fmt"
 	"log"
+	"qianmianyao/MistChat-Server/internal/models/dot"
 	"qianmianyao/MistChat-Server/internal/models/entity"
 	"sync"
 
@@ -33,17 +34,87 @@ func InitDB() *gorm.DB {
 
 		models := []interface{}{
 			&entity.ChatUser{},
+			&entity.Device{},
 			&entity.Room{},
 			&entity.RoomMembers{},
+			&entity.RoomBan{},
+			&entity.RoomInvite{},
+			&entity.RoomMessage{},
+			&entity.MessageReaction{},
+			&entity.Attachment{},
+			&entity.OfflineMessage{},
+			&entity.MessageReceipt{},
+			&entity.SenderKeyDistribution{},
 			&entity.SignalIdentityKey{},
+			&entity.SignalIdentityKeyHistory{},
 			&entity.SignalSignedPreKey{},
 			&entity.SignalPreKey{},
 		}
 
+		// 成员表加唯一索引前，重复加入留下的多余成员记录需先清除，保留角色最高、加入最早的一条
+		if db.Migrator().HasTable(&entity.RoomMembers{}) &&
+			!db.Migrator().HasIndex(&entity.RoomMembers{}, "idx_room_member_room_user") {
+			order := "id"
+			if db.Migrator().HasColumn(&entity.RoomMembers{}, "role") {
+				order = "CASE role WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END, id"
+			}
+			if err := db.Exec(`UPDATE room_members SET deleted_at = NOW() WHERE deleted_at IS NULL AND id NOT IN (
+				SELECT DISTINCT ON (room_uuid, chat_user_uuid) id FROM room_members WHERE deleted_at IS NULL
+				ORDER BY room_uuid, chat_user_uuid, ` + order + `)`).Error; err != nil {
+				log.Fatalf("Failed to remove duplicate room members: %v", err)
+			}
+		}
+
+		// 角色字段首次加入时才需要补登房主，必须在迁移前检查
+		needsOwnerBackfill := db.Migrator().HasTable(&entity.RoomMembers{}) &&
+			!db.Migrator().HasColumn(&entity.RoomMembers{}, "role")
+
 		if err := db.AutoMigrate(models...); err != nil {
 			log.Fatalf("Databses failed to migrate: %v", err)
 		}
 
+		// 身份密钥改为按设备唯一，移除旧的按用户唯一索引
+		if db.Migrator().HasIndex(&entity.SignalIdentityKey{}, "idx_signal_identity_keys_chat_user_uuid") {
+			if err := db.Migrator().DropIndex(&entity.SignalIdentityKey{}, "idx_signal_identity_keys_chat_user_uuid"); err != nil {
+				log.Fatalf("Failed to drop legacy identity key index: %v", err)
+			}
+		}
+
+		// Sender Key 分发改为按接收设备记录，移除旧的按接收用户唯一索引
+		if db.Migrator().HasIndex(&entity.SenderKeyDistribution{}, "idx_sender_key_room_sender_recipient") {
+			if err := db.Migrator().DropIndex(&entity.SenderKeyDistribution{}, "idx_sender_key_room_sender_recipient"); err != nil {
+				log.Fatalf("Failed to drop legacy sender key distribution index: %v", err)
+			}
+		}
+
+		// 一次性密钥改为取用即删除，清理旧的已使用标记
+		if db.Migrator().HasColumn(&entity.SignalPreKey{}, "is_used") {
+			if err := db.Exec("DELETE FROM signal_pre_keys WHERE is_used = true").Error; err != nil {
+				log.Fatalf("Failed to purge used prekeys: %v", err)
+			}
+			if err := db.Migrator().DropColumn(&entity.SignalPreKey{}, "is_used"); err != nil {
+				log.Fatalf("Failed to drop legacy is_used column: %v", err)
+			}
+		}
+
+		// 设备表上线前注册的用户没有设备记录，为其补登主设备；已有过设备记录（包括已删除）的用户不受影响
+		if err := db.Exec(`INSERT INTO devices (created_at, updated_at, chat_user_uuid, device_id)
+			SELECT NOW(), NOW(), chat_users.uuid, ? FROM chat_users
+			WHERE chat_users.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM devices WHERE devices.chat_user_uuid = chat_users.uuid)`, dot.DefaultDeviceId).Error; err != nil {
+			log.Fatalf("Failed to backfill primary devices: %v", err)
+		}
+
+		// 角色字段上线前创建的房间没有房主，将每个房间最早加入的成员（即创建者）设为房主
+		// 仅在本次启动新增角色字段时执行，之后房主离开等情况不应被自动改写
+		if needsOwnerBackfill {
+			if err := db.Exec(`UPDATE room_members SET role = ? WHERE id IN (
+				SELECT MIN(id) FROM room_members WHERE deleted_at IS NULL
+				GROUP BY room_uuid HAVING NOT bool_or(role = ?))`, entity.RoomRoleOwner, entity.RoomRoleOwner).Error; err != nil {
+				log.Fatalf("Failed to backfill room owners: %v", err)
+			}
+		}
+
 		// 设置全局DB变量
 		global.DB = db
 	})
@@ -39,6 +39,16 @@ func GenerateUID(prefix string) (string, error) {
 	return prefix + uid, nil
 }
 
+// GenerateRandomID 使用 Base58 编码生成由 size 字节随机数构成的不可预测 ID，不含时间戳与签名。
+// 用于邀请码等需要防猜测的凭据，size 应不小于 16（128 位）。
+func GenerateRandomID(prefix string, size int) (string, error) {
+	raw := make([]byte, size)
+	if _, err := crand.Read(raw); err != nil {
+		return "", err
+	}
+	return prefix + base58.Encode(raw), nil
+}
+
 // ValidateUID 校验 Base58 编码的 UID
 func ValidateUID(uid, prefix string) (bool, error) {
 	if len(uid) <= len(prefix) || uid[:len(prefix)] != prefix {
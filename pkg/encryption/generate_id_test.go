@@ -2,7 +2,10 @@ package encryption
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+
+	"github.com/btcsuite/btcutil/base58"
 )
 
 func Test_generateUID(t *testing.T) {
@@ -36,3 +39,23 @@ func Test_generateUID(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateRandomID(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		got, err := GenerateRandomID("i_", 16)
+		if err != nil {
+			t.Fatalf("GenerateRandomID() error = %v", err)
+		}
+		if !strings.HasPrefix(got, "i_") {
+			t.Fatalf("GenerateRandomID() = %v, want prefix i_", got)
+		}
+		if raw := base58.Decode(strings.TrimPrefix(got, "i_")); len(raw) != 16 {
+			t.Fatalf("GenerateRandomID() decoded %d bytes, want 16", len(raw))
+		}
+		if seen[got] {
+			t.Fatalf("GenerateRandomID() repeated %v", got)
+		}
+		seen[got] = true
+	}
+}
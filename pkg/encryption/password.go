@@ -0,0 +1,82 @@
+package encryption
+
+import (
+	crand "crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id 参数，参考 OWASP 推荐的最低配置
+const (
+	argon2Time    = 2
+	argon2Memory  = 19 * 1024
+	argon2Threads = 1
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+const argon2Prefix = "$argon2id$"
+
+// HashPassword 使用 Argon2id 计算密码哈希，返回 PHC 字符串格式：
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := crand.Read(salt); err != nil {
+		return "", err
+	}
+	hash := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix, argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// VerifyPassword 以常量时间校验密码。
+// stored 不是 Argon2id 哈希时视为历史遗留的明文，校验通过后 needsRehash 为 true，调用方应重新计算哈希保存。
+func VerifyPassword(stored, password string) (ok bool, needsRehash bool) {
+	if !strings.HasPrefix(stored, argon2Prefix) {
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+
+	salt, hash, params, err := decodeArgon2Hash(stored)
+	if err != nil {
+		return false, false
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(hash)))
+	ok = subtle.ConstantTimeCompare(hash, computed) == 1
+	// 参数低于当前配置的旧哈希同样需要升级
+	needsRehash = ok && (params.time != argon2Time || params.memory != argon2Memory || params.threads != argon2Threads)
+	return ok, needsRehash
+}
+
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// decodeArgon2Hash 解析 PHC 格式的 Argon2id 哈希
+func decodeArgon2Hash(encoded string) (salt, hash []byte, params argon2Params, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return nil, nil, params, errors.New("invalid argon2 hash format")
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, params, errors.New("unsupported argon2 version")
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return nil, nil, params, err
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, nil, params, err
+	}
+	if hash, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, nil, params, err
+	}
+	return salt, hash, params, nil
+}
@@ -0,0 +1,31 @@
+package encryption
+
+import "testing"
+
+func TestVerifyPassword(t *testing.T) {
+	hashed, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		stored          string
+		password        string
+		wantOk          bool
+		wantNeedsRehash bool
+	}{
+		{name: "哈希匹配", stored: hashed, password: "correct horse", wantOk: true},
+		{name: "哈希不匹配", stored: hashed, password: "wrong", wantOk: false},
+		{name: "明文匹配需要升级", stored: "legacy", password: "legacy", wantOk: true, wantNeedsRehash: true},
+		{name: "明文不匹配", stored: "legacy", password: "wrong", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash := VerifyPassword(tt.stored, tt.password)
+			if ok != tt.wantOk || needsRehash != tt.wantNeedsRehash {
+				t.Errorf("VerifyPassword() = (%v, %v), want (%v, %v)", ok, needsRehash, tt.wantOk, tt.wantNeedsRehash)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"strconv"
+	"time"
+)
+
+// SignResource 为资源路径生成带过期时间的 HMAC-SHA256 签名，用于限时下载链接
+func SignResource(resource string, expiresAt time.Time, secret []byte) string {
+	return signToken(resource+"\n"+strconv.FormatInt(expiresAt.Unix(), 10), secret)
+}
+
+// VerifyResource 校验资源签名，签名不符返回 ErrTokenInvalid，已过期返回 ErrTokenExpired
+func VerifyResource(resource string, expires int64, signature string, secret []byte) error {
+	expected := SignResource(resource, time.Unix(expires, 0), secret)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrTokenInvalid
+	}
+	if time.Now().Unix() >= expires {
+		return ErrTokenExpired
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package encryption
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyResource(t *testing.T) {
+	secret := []byte("test_secret")
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Second)
+
+	tests := []struct {
+		name      string
+		resource  string
+		expires   time.Time
+		signature string
+		wantErr   error
+	}{
+		{name: "有效签名", resource: "a_1", expires: future, signature: SignResource("a_1", future, secret)},
+		{name: "已过期", resource: "a_1", expires: past, signature: SignResource("a_1", past, secret), wantErr: ErrTokenExpired},
+		{name: "资源不符", resource: "a_2", expires: future, signature: SignResource("a_1", future, secret), wantErr: ErrTokenInvalid},
+		{name: "篡改过期时间", resource: "a_1", expires: future.Add(time.Hour), signature: SignResource("a_1", future, secret), wantErr: ErrTokenInvalid},
+		{name: "密钥不符", resource: "a_1", expires: future, signature: SignResource("a_1", future, []byte("other")), wantErr: ErrTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyResource(tt.resource, tt.expires.Unix(), tt.signature, secret)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyResource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
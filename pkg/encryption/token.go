@@ -0,0 +1,82 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// TokenType 区分访问令牌与刷新令牌
+type TokenType string
+
+const (
+	AccessToken  TokenType = "access"
+	RefreshToken TokenType = "refresh"
+)
+
+var (
+	ErrTokenInvalid = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// TokenClaims 令牌中携带的声明
+type TokenClaims struct {
+	UUID      string    `json:"uid"`
+	Type      TokenType `json:"typ"`
+	ID        string    `json:"jti,omitempty"` // 刷新令牌的唯一标识，用于轮换与吊销
+	ExpiresAt int64     `json:"exp"`
+}
+
+// GenerateToken 生成 HMAC-SHA256 签名的会话令牌，格式为 payload.signature。tokenID 为空时令牌不携带唯一标识
+func GenerateToken(uuid string, tokenType TokenType, tokenID string, ttl time.Duration, secret []byte) (string, time.Time, error) {
+	expiresAt := time.Now().Add(ttl)
+	payload, err := json.Marshal(TokenClaims{
+		UUID:      uuid,
+		Type:      tokenType,
+		ID:        tokenID,
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + signToken(encoded, secret), expiresAt, nil
+}
+
+// ParseToken 校验令牌签名、类型与有效期，并返回其中的声明
+func ParseToken(token string, tokenType TokenType, secret []byte) (*TokenClaims, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrTokenInvalid
+	}
+	if !hmac.Equal([]byte(sig), []byte(signToken(encoded, secret))) {
+		return nil, ErrTokenInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	var claims TokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if claims.Type != tokenType || claims.UUID == "" {
+		return nil, ErrTokenInvalid
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+func signToken(encoded string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,38 @@
+package encryption
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseToken(t *testing.T) {
+	secret := []byte("test_secret")
+	valid, _, _ := GenerateToken("u_test", AccessToken, "", time.Hour, secret)
+	expired, _, _ := GenerateToken("u_test", AccessToken, "", -time.Second, secret)
+	refresh, _, _ := GenerateToken("u_test", RefreshToken, "r_test", time.Hour, secret)
+
+	tests := []struct {
+		name    string
+		token   string
+		secret  []byte
+		wantErr error
+	}{
+		{name: "有效令牌", token: valid, secret: secret},
+		{name: "已过期", token: expired, secret: secret, wantErr: ErrTokenExpired},
+		{name: "类型不符", token: refresh, secret: secret, wantErr: ErrTokenInvalid},
+		{name: "密钥不符", token: valid, secret: []byte("other"), wantErr: ErrTokenInvalid},
+		{name: "格式错误", token: "garbage", secret: secret, wantErr: ErrTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseToken(tt.token, AccessToken, tt.secret)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && claims.UUID != "u_test" {
+				t.Errorf("ParseToken() uuid = %v, want u_test", claims.UUID)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package encryption
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"math/big"
+)
+
+// djbKeyType 是 Signal 序列化 Curve25519 公钥时使用的类型前缀
+const djbKeyType = 0x05
+
+// fieldPrime 是 Curve25519 的基域素数 2^255 - 19
+var fieldPrime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// DecodeSignalPublicKey 解码 Base64 编码的 Signal 公钥，返回 32 字节的 Curve25519 公钥。
+// 同时接受带 0x05 类型前缀的 33 字节序列化格式与不带前缀的 32 字节格式。
+func DecodeSignalPublicKey(encoded string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(raw) == 33 && raw[0] == djbKeyType:
+		return raw[1:], nil
+	case len(raw) == 32:
+		return raw, nil
+	default:
+		return nil, errors.New("invalid public key length")
+	}
+}
+
+// VerifyXEdDSA 使用 Curve25519 身份公钥校验 XEdDSA 签名。
+// 按 XEdDSA 规范将 Montgomery u 坐标转换为 Edwards 公钥，签名最高位携带符号位，随后按 Ed25519 校验。
+func VerifyXEdDSA(publicKey, message, signature []byte) bool {
+	if len(publicKey) != 32 || len(signature) != ed25519.SignatureSize {
+		return false
+	}
+
+	// 小端序 u 坐标，忽略第 255 位
+	le := make([]byte, 32)
+	copy(le, publicKey)
+	le[31] &= 0x7f
+	u := new(big.Int).SetBytes(reverse(le))
+	if u.Cmp(fieldPrime) >= 0 {
+		return false
+	}
+
+	// y = (u - 1) / (u + 1) mod p
+	denominator := new(big.Int).Add(u, big.NewInt(1))
+	denominator.Mod(denominator, fieldPrime)
+	if denominator.Sign() == 0 {
+		return false
+	}
+	y := new(big.Int).Sub(u, big.NewInt(1))
+	y.Mul(y, new(big.Int).ModInverse(denominator, fieldPrime))
+	y.Mod(y, fieldPrime)
+
+	edPublicKey := make([]byte, 32)
+	y.FillBytes(edPublicKey)
+	edPublicKey = reverse(edPublicKey)
+	edPublicKey[31] |= signature[63] & 0x80
+
+	sig := make([]byte, ed25519.SignatureSize)
+	copy(sig, signature)
+	sig[63] &= 0x7f
+
+	return ed25519.Verify(edPublicKey, message, sig)
+}
+
+// reverse 返回字节序反转后的副本，用于在小端序编码与 big.Int 之间转换
+func reverse(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
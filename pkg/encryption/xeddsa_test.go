@@ -0,0 +1,57 @@
+package encryption
+
+import (
+	"crypto/ed25519"
+	crand "crypto/rand"
+	"math/big"
+	"testing"
+)
+
+// montgomeryFromEd25519 将 Ed25519 公钥转换为 Curve25519 u 坐标：u = (1 + y) / (1 - y)
+func montgomeryFromEd25519(edPublicKey ed25519.PublicKey) []byte {
+	le := make([]byte, 32)
+	copy(le, edPublicKey)
+	le[31] &= 0x7f
+	y := new(big.Int).SetBytes(reverse(le))
+
+	numerator := new(big.Int).Add(big.NewInt(1), y)
+	denominator := new(big.Int).Sub(big.NewInt(1), y)
+	denominator.Mod(denominator, fieldPrime)
+	u := numerator.Mul(numerator, new(big.Int).ModInverse(denominator, fieldPrime))
+	u.Mod(u, fieldPrime)
+
+	out := make([]byte, 32)
+	u.FillBytes(out)
+	return reverse(out)
+}
+
+func TestVerifyXEdDSA(t *testing.T) {
+	edPublicKey, edPrivateKey, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityKey := montgomeryFromEd25519(edPublicKey)
+	message := append([]byte{djbKeyType}, make([]byte, 32)...)
+
+	signature := ed25519.Sign(edPrivateKey, message)
+	signature[63] |= edPublicKey[31] & 0x80
+
+	tampered := append([]byte(nil), message...)
+	tampered[1] ^= 0x01
+
+	tests := []struct {
+		name    string
+		message []byte
+		want    bool
+	}{
+		{name: "签名有效", message: message, want: true},
+		{name: "消息被篡改", message: tampered, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyXEdDSA(identityKey, tt.message, signature); got != tt.want {
+				t.Errorf("VerifyXEdDSA() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// maxTkhdSize tkhd box 内容的读取上限，version 1 的 tkhd 内容为 92 字节
+const maxTkhdSize = 256
+
+var errMalformedBox = errors.New("malformed ISO BMFF box")
+
+// isISOBMFF 判断内容是否以 ftyp box 开头（MP4、QuickTime、HEIF 等 ISO BMFF 容器）
+func isISOBMFF(head []byte) bool {
+	return len(head) >= 8 && string(head[4:8]) == "ftyp"
+}
+
+// videoDimensions 在 ISO BMFF 容器的 moov/trak/tkhd 中查找第一个有画面的轨道，返回其显示宽高。
+// 轨道带有 90° 或 270° 旋转矩阵时交换宽高，与播放器显示的方向一致。
+func videoDimensions(r io.Reader) (width, height int, err error) {
+	moov, err := findBox(r, "moov")
+	if err != nil {
+		return 0, 0, err
+	}
+	for {
+		trak, err := findBox(moov, "trak")
+		if err != nil {
+			return 0, 0, err
+		}
+		if tkhd, err := findBox(trak, "tkhd"); err == nil {
+			payload, err := io.ReadAll(io.LimitReader(tkhd, maxTkhdSize))
+			if err != nil {
+				return 0, 0, err
+			}
+			if width, height, ok := tkhdDimensions(payload); ok {
+				return width, height, nil
+			}
+		}
+		// 跳过该轨道剩余的内容，继续查找下一个轨道
+		if _, err := io.Copy(io.Discard, trak); err != nil {
+			return 0, 0, err
+		}
+	}
+}
+
+// tkhdDimensions 解析 tkhd box 内容中的宽高（16.16 定点数），音频等没有画面的轨道返回 false
+func tkhdDimensions(payload []byte) (width, height int, ok bool) {
+	if len(payload) == 0 {
+		return 0, 0, false
+	}
+	// version 1 的时间字段为 64 位，矩阵与宽高相应后移
+	matrix := 40
+	if payload[0] == 1 {
+		matrix = 52
+	}
+	if len(payload) < matrix+44 {
+		return 0, 0, false
+	}
+	width = int(binary.BigEndian.Uint32(payload[matrix+36:]) >> 16)
+	height = int(binary.BigEndian.Uint32(payload[matrix+40:]) >> 16)
+	if width == 0 || height == 0 {
+		return 0, 0, false
+	}
+	a := binary.BigEndian.Uint32(payload[matrix:])
+	d := binary.BigEndian.Uint32(payload[matrix+16:])
+	if a == 0 && d == 0 {
+		width, height = height, width
+	}
+	return width, height, true
+}
+
+// findBox 依次跳过 r 中的 box 直到找到 boxType，返回其内容；r 需位于某个 box 头的起始处
+func findBox(r io.Reader, boxType string) (io.Reader, error) {
+	for {
+		name, size, err := readBoxHeader(r)
+		if err != nil {
+			return nil, err
+		}
+		if name == boxType {
+			if size < 0 {
+				return r, nil
+			}
+			return io.LimitReader(r, size), nil
+		}
+		if size < 0 {
+			return nil, io.EOF
+		}
+		if _, err := io.CopyN(io.Discard, r, size); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readBoxHeader 读取 box 头，返回类型与内容长度；内容延伸到容器末尾时长度为 -1
+func readBoxHeader(r io.Reader) (string, int64, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return "", 0, err
+	}
+	name := string(header[4:8])
+	size := int64(binary.BigEndian.Uint32(header[:4]))
+	switch size {
+	case 0:
+		return name, -1, nil
+	case 1:
+		var extended [8]byte
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			return "", 0, err
+		}
+		size = int64(binary.BigEndian.Uint64(extended[:]))
+		if size < 16 {
+			return "", 0, errMalformedBox
+		}
+		return name, size - 16, nil
+	default:
+		if size < 8 {
+			return "", 0, errMalformedBox
+		}
+		return name, size - 8, nil
+	}
+}
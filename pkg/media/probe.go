@@ -0,0 +1,115 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"  // 注册 GIF 解码器
+	_ "image/jpeg" // 注册 JPEG 解码器
+	_ "image/png"  // 注册 PNG 解码器
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	// sniffLen http.DetectContentType 最多使用的字节数
+	sniffLen = 512
+	// unknownType http.DetectContentType 无法识别内容时返回的类型
+	unknownType = "application/octet-stream"
+)
+
+var (
+	ErrTypeMismatch      = errors.New("content type does not match declared type")
+	ErrDimensionMismatch = errors.New("media dimensions do not match declared dimensions")
+)
+
+// sniffableTypes http.DetectContentType 能够识别的图片与视频类型，只有这些类型可以与嗅探结果直接比对
+var sniffableTypes = map[string]bool{
+	"image/bmp":    true,
+	"image/gif":    true,
+	"image/jpeg":   true,
+	"image/png":    true,
+	"image/webp":   true,
+	"image/x-icon": true,
+	"video/avi":    true,
+	"video/mp4":    true,
+	"video/webm":   true,
+}
+
+// Metadata 从明文内容中嗅探出的媒体信息，无法解析尺寸时 Width 与 Height 为 0
+type Metadata struct {
+	MimeType string
+	Width    int
+	Height   int
+}
+
+// Probe 读取内容头部嗅探 MIME 类型，PNG、JPEG 与 GIF 图片以及 MP4、QuickTime 视频同时解析出尺寸。
+// 视频的 moov 位于文件末尾时需要读完整个内容才能得到尺寸。
+func Probe(r io.Reader) (Metadata, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return Metadata{}, err
+	}
+	head = head[:n]
+
+	meta := Metadata{MimeType: BaseType(http.DetectContentType(head))}
+	if IsImage(meta.MimeType) {
+		if cfg, _, err := image.DecodeConfig(io.MultiReader(bytes.NewReader(head), r)); err == nil {
+			meta.Width, meta.Height = cfg.Width, cfg.Height
+		}
+	} else if isISOBMFF(head) {
+		if width, height, err := videoDimensions(io.MultiReader(bytes.NewReader(head), r)); err == nil {
+			meta.Width, meta.Height = width, height
+		}
+	}
+	return meta, nil
+}
+
+// Verify 校验嗅探结果与客户端的声明一致。
+// 声明为嗅探器能够识别的图片或视频类型时 MIME 类型必须相同；
+// 声明为嗅探器无法识别的类型（如 video/quicktime、image/heic、image/heif）时无法确认类型，只要求内容没有被识别为其他类型。
+// 声明了尺寸且能解析出尺寸时尺寸也必须相同。
+func (m Metadata) Verify(mimeType string, width, height int) error {
+	declared := BaseType(mimeType)
+	if (IsImage(declared) || IsVideo(declared)) && !m.matchesType(declared) {
+		return ErrTypeMismatch
+	}
+	if m.Width > 0 && (width != 0 || height != 0) && (width != m.Width || height != m.Height) {
+		return ErrDimensionMismatch
+	}
+	return nil
+}
+
+// matchesType 判断嗅探出的类型是否与声明的图片或视频类型相符
+func (m Metadata) matchesType(declared string) bool {
+	if sniffableTypes[declared] {
+		return m.MimeType == declared
+	}
+	// QuickTime 文件兼容 MP4 时会被识别为 video/mp4
+	return m.MimeType == unknownType || (declared == "video/quicktime" && m.MimeType == "video/mp4")
+}
+
+// BaseType 去掉 MIME 类型中的参数并转为小写，无法解析时返回空字符串
+func BaseType(mimeType string) string {
+	if mimeType == "" {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// IsImage 判断 MIME 类型是否为图片
+func IsImage(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/")
+}
+
+// IsVideo 判断 MIME 类型是否为视频
+func IsVideo(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "video/")
+}
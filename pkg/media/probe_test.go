@@ -0,0 +1,139 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func pngBytes(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("png.Encode() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+// box 组装一个 ISO BMFF box
+func box(name string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, name...), body...)
+}
+
+// tkhd 组装 version 0 的 tkhd box，rotated 为 true 时写入 90° 旋转矩阵
+func tkhd(width, height int, rotated bool) []byte {
+	payload := make([]byte, 84)
+	a, b, c, d := uint32(0x10000), uint32(0), uint32(0), uint32(0x10000)
+	if rotated {
+		a, b, c, d = 0, 0x10000, 0xFFFF0000, 0
+	}
+	binary.BigEndian.PutUint32(payload[40:], a)
+	binary.BigEndian.PutUint32(payload[44:], b)
+	binary.BigEndian.PutUint32(payload[52:], c)
+	binary.BigEndian.PutUint32(payload[56:], d)
+	binary.BigEndian.PutUint32(payload[72:], 0x40000000)
+	binary.BigEndian.PutUint32(payload[76:], uint32(width)<<16)
+	binary.BigEndian.PutUint32(payload[80:], uint32(height)<<16)
+	return box("tkhd", payload)
+}
+
+// movie 组装 moov 位于 mdat 之后的视频文件，第一个轨道为没有画面的音频轨道
+func movie(brand string, width, height int, rotated bool) []byte {
+	return bytes.Join([][]byte{
+		box("ftyp", []byte(brand), make([]byte, 4), []byte(brand)),
+		box("mdat", make([]byte, 1024)),
+		box("moov",
+			box("mvhd", make([]byte, 100)),
+			box("trak", tkhd(0, 0, false), box("mdia", make([]byte, 32))),
+			box("trak", tkhd(width, height, rotated)),
+		),
+	}, nil)
+}
+
+func TestProbe(t *testing.T) {
+	meta, err := Probe(bytes.NewReader(pngBytes(t, 40, 30)))
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if meta != (Metadata{MimeType: "image/png", Width: 40, Height: 30}) {
+		t.Errorf("Probe() = %+v", meta)
+	}
+
+	meta, err = Probe(strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if meta.MimeType != "text/plain" || meta.Width != 0 {
+		t.Errorf("Probe() = %+v, want text/plain without dimensions", meta)
+	}
+}
+
+func TestProbeVideo(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want Metadata
+	}{
+		{name: "MP4", data: movie("mp42", 1280, 720, false), want: Metadata{MimeType: "video/mp4", Width: 1280, Height: 720}},
+		{name: "旋转的 MP4", data: movie("mp42", 1920, 1080, true), want: Metadata{MimeType: "video/mp4", Width: 1080, Height: 1920}},
+		{name: "QuickTime", data: movie("qt  ", 640, 480, false), want: Metadata{MimeType: "application/octet-stream", Width: 640, Height: 480}},
+		{name: "缺少 moov", data: box("ftyp", []byte("mp42"), make([]byte, 4), []byte("mp42")), want: Metadata{MimeType: "video/mp4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, err := Probe(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("Probe() error = %v", err)
+			}
+			if meta != tt.want {
+				t.Errorf("Probe() = %+v, want %+v", meta, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetadataVerify(t *testing.T) {
+	png := Metadata{MimeType: "image/png", Width: 40, Height: 30}
+	text := Metadata{MimeType: "text/plain"}
+	mp4 := Metadata{MimeType: "video/mp4", Width: 1280, Height: 720}
+	unknown := Metadata{MimeType: "application/octet-stream"}
+
+	tests := []struct {
+		name     string
+		meta     Metadata
+		mimeType string
+		width    int
+		height   int
+		wantErr  error
+	}{
+		{name: "类型与尺寸一致", meta: png, mimeType: "image/png", width: 40, height: 30},
+		{name: "未声明尺寸", meta: png, mimeType: "IMAGE/PNG"},
+		{name: "尺寸不符", meta: png, mimeType: "image/png", width: 30, height: 40, wantErr: ErrDimensionMismatch},
+		{name: "图片类型不符", meta: png, mimeType: "image/jpeg", wantErr: ErrTypeMismatch},
+		{name: "伪装为图片", meta: text, mimeType: "image/png", wantErr: ErrTypeMismatch},
+		{name: "普通文件不校验类型", meta: text, mimeType: "application/pdf"},
+		{name: "视频尺寸一致", meta: mp4, mimeType: "video/mp4", width: 1280, height: 720},
+		{name: "视频尺寸不符", meta: mp4, mimeType: "video/mp4", width: 640, height: 480, wantErr: ErrDimensionMismatch},
+		{name: "无法识别的内容伪装为 MP4", meta: unknown, mimeType: "video/mp4", wantErr: ErrTypeMismatch},
+		{name: "QuickTime 无法嗅探", meta: unknown, mimeType: "video/quicktime"},
+		{name: "兼容 MP4 的 QuickTime", meta: mp4, mimeType: "video/quicktime"},
+		{name: "HEIC 无法嗅探", meta: unknown, mimeType: "image/heic"},
+		{name: "HEIF 无法嗅探", meta: unknown, mimeType: "image/heif"},
+		{name: "文本伪装为 HEIC", meta: text, mimeType: "image/heic", wantErr: ErrTypeMismatch},
+		{name: "PNG 伪装为 QuickTime", meta: png, mimeType: "video/quicktime", wantErr: ErrTypeMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.meta.Verify(tt.mimeType, tt.width, tt.height)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
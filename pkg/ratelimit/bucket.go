@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket 令牌桶限流器，按固定速率补充令牌，允许不超过容量的突发
+type TokenBucket struct {
+	mu       sync.Mutex
+	rate     float64 // 每秒补充的令牌数
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// NewTokenBucket 创建令牌桶，初始时桶是满的
+func NewTokenBucket(rate float64, capacity int) *TokenBucket {
+	return &TokenBucket{
+		rate:     rate,
+		capacity: float64(capacity),
+		tokens:   float64(capacity),
+		last:     time.Now(),
+	}
+}
+
+// Allow 取出一个令牌，令牌不足时返回 false
+func (b *TokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,20 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	bucket := NewTokenBucket(100, 2)
+	if !bucket.Allow() || !bucket.Allow() {
+		t.Fatal("Allow() = false within burst, want true")
+	}
+	if bucket.Allow() {
+		t.Fatal("Allow() = true after burst exhausted, want false")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if !bucket.Allow() {
+		t.Error("Allow() = false after refill, want true")
+	}
+}
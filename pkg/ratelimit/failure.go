@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// FailureLimiter 在固定时间窗口内统计失败次数，超过上限的键在窗口结束前被拒绝
+type FailureLimiter struct {
+	mu        sync.Mutex
+	window    time.Duration
+	entries   map[string]*failureEntry
+	lastSweep time.Time
+}
+
+type failureEntry struct {
+	count     int
+	expiresAt time.Time
+}
+
+// NewFailureLimiter 创建失败计数器，window 为计数窗口长度
+func NewFailureLimiter(window time.Duration) *FailureLimiter {
+	return &FailureLimiter{
+		window:    window,
+		entries:   make(map[string]*failureEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Blocked 判断键在当前窗口内的失败次数是否已达到 max
+func (l *FailureLimiter) Blocked(key string, max int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return false
+	}
+	return entry.count >= max
+}
+
+// Fail 记录一次失败，窗口从该键的第一次失败开始计算
+func (l *FailureLimiter) Fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+	entry, ok := l.entries[key]
+	if !ok || now.After(entry.expiresAt) {
+		l.entries[key] = &failureEntry{count: 1, expiresAt: now.Add(l.window)}
+		return
+	}
+	entry.count++
+}
+
+// Reset 清除键的失败记录
+func (l *FailureLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+// sweep 每个窗口清理一次过期记录，避免长期运行时无限增长；调用方需持有锁
+func (l *FailureLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	for key, entry := range l.entries {
+		if now.After(entry.expiresAt) {
+			delete(l.entries, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,39 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFailureLimiter(t *testing.T) {
+	limiter := NewFailureLimiter(time.Minute)
+	for i := 0; i < 3; i++ {
+		if limiter.Blocked("ip:127.0.0.1", 3) {
+			t.Fatalf("Blocked() = true after %d failures, want false", i)
+		}
+		limiter.Fail("ip:127.0.0.1")
+	}
+	if !limiter.Blocked("ip:127.0.0.1", 3) {
+		t.Fatal("Blocked() = false after 3 failures, want true")
+	}
+	if limiter.Blocked("ip:127.0.0.2", 3) {
+		t.Error("Blocked() = true for unrelated key, want false")
+	}
+
+	limiter.Reset("ip:127.0.0.1")
+	if limiter.Blocked("ip:127.0.0.1", 3) {
+		t.Error("Blocked() = true after Reset, want false")
+	}
+}
+
+func TestFailureLimiterWindowExpiry(t *testing.T) {
+	limiter := NewFailureLimiter(10 * time.Millisecond)
+	limiter.Fail("room:r_test")
+	if !limiter.Blocked("room:r_test", 1) {
+		t.Fatal("Blocked() = false, want true")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if limiter.Blocked("room:r_test", 1) {
+		t.Error("Blocked() = true after window expired, want false")
+	}
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Local 将对象保存在本地文件系统的存储后端。
+// 完整对象保存为 root/key，未合并的分片保存在 root/key.parts/ 目录下。
+type Local struct {
+	root string
+}
+
+// NewLocal 创建以 root 为根目录的本地存储，目录不存在时自动创建
+func NewLocal(root string) (*Local, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, err
+	}
+	return &Local{root: root}, nil
+}
+
+// path 返回对象的文件路径，拒绝可能逃出根目录的 key
+func (l *Local) path(key string) (string, error) {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.root, key), nil
+}
+
+func (l *Local) partsDir(key string) (string, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return "", err
+	}
+	return p + ".parts", nil
+}
+
+func (l *Local) PutPart(_ context.Context, key string, part int, r io.Reader) (int64, error) {
+	if part < 0 {
+		return 0, fmt.Errorf("invalid part %d", part)
+	}
+	dir, err := l.partsDir(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return 0, err
+	}
+
+	// 先写入临时文件再重命名，避免中断的请求留下不完整的分片
+	tmp, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return n, err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, strconv.Itoa(part))); err != nil {
+		_ = os.Remove(tmp.Name())
+		return n, err
+	}
+	return n, nil
+}
+
+func (l *Local) Complete(_ context.Context, key string, parts int) error {
+	target, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	dir, _ := l.partsDir(key)
+
+	// 此前已合并完成，分片已被清理
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(target); err == nil {
+			return nil
+		}
+	}
+
+	tmp, err := os.CreateTemp(l.root, key+".complete-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	for part := 0; part < parts; part++ {
+		if err := appendFile(tmp, filepath.Join(dir, strconv.Itoa(part))); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// appendFile 将 src 的内容追加到 dst
+func appendFile(dst *os.File, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNotFound
+		}
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(dst, f)
+	return err
+}
+
+func (l *Local) Open(_ context.Context, key string) (io.ReadCloser, int64, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, 0, ErrNotFound
+		}
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+func (l *Local) Delete(_ context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.RemoveAll(p + ".parts")
+}
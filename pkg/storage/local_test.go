@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalPartsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	l, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocal() error = %v", err)
+	}
+
+	// 乱序写入并重复写入同一分片，合并结果应按分片序号排列且以最后一次写入为准
+	parts := []string{"hello ", "old", "world"}
+	for _, i := range []int{2, 0, 1} {
+		if _, err := l.PutPart(ctx, "a_test", i, strings.NewReader(parts[i])); err != nil {
+			t.Fatalf("PutPart(%d) error = %v", i, err)
+		}
+	}
+	if _, err := l.PutPart(ctx, "a_test", 1, strings.NewReader("new ")); err != nil {
+		t.Fatalf("PutPart(1) error = %v", err)
+	}
+	if err := l.Complete(ctx, "a_test", 3); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+
+	r, size, err := l.Open(ctx, "a_test")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	_ = r.Close()
+	if string(data) != "hello new world" || size != int64(len(data)) {
+		t.Errorf("Open() = %q (size %d), want %q", data, size, "hello new world")
+	}
+
+	if err := l.Delete(ctx, "a_test"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, _, err := l.Open(ctx, "a_test"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open() after Delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalRejectsInvalidKey(t *testing.T) {
+	l, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocal() error = %v", err)
+	}
+	for _, key := range []string{"", "..", "../escape", "a/b"} {
+		if _, err := l.PutPart(context.Background(), key, 0, strings.NewReader("x")); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("PutPart(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestLocalCompleteMissingPart(t *testing.T) {
+	ctx := context.Background()
+	l, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocal() error = %v", err)
+	}
+	if _, err := l.PutPart(ctx, "a_test", 0, strings.NewReader("x")); err != nil {
+		t.Fatalf("PutPart() error = %v", err)
+	}
+	if err := l.Complete(ctx, "a_test", 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Complete() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalCompleteTwice(t *testing.T) {
+	ctx := context.Background()
+	l, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocal() error = %v", err)
+	}
+	if _, err := l.PutPart(ctx, "a_test", 0, strings.NewReader("data")); err != nil {
+		t.Fatalf("PutPart() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := l.Complete(ctx, "a_test", 1); err != nil {
+			t.Fatalf("Complete() call %d error = %v", i+1, err)
+		}
+	}
+	r, _, err := l.Open(ctx, "a_test")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	_ = r.Close()
+	if string(data) != "data" {
+		t.Errorf("Open() = %q, want %q", data, "data")
+	}
+}
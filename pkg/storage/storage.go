@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"qianmianyao/MistChat-Server/internal/models/config"
+)
+
+var (
+	ErrNotFound   = errors.New("object not found")
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// Storage 附件对象存储后端。
+// 对象按分片写入，全部分片写入后调用 Complete 合并为完整对象，语义与 S3 的分片上传一致，
+// 便于之后接入 S3 兼容的后端；重复写入同一分片会覆盖此前的内容。
+type Storage interface {
+	// PutPart 写入对象 key 的第 part 个分片（从 0 开始）
+	PutPart(ctx context.Context, key string, part int, r io.Reader) (int64, error)
+	// Complete 按顺序合并 parts 个分片为完整对象，并清理分片；对象已合并且分片已清理时重复调用不返回错误
+	Complete(ctx context.Context, key string, parts int) error
+	// Open 打开完整对象，同时返回对象大小
+	Open(ctx context.Context, key string) (io.ReadCloser, int64, error)
+	// Delete 删除对象及其未合并的分片，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+}
+
+// New 根据配置创建存储后端
+func New(cfg config.StorageConfig) (Storage, error) {
+	switch cfg.Backend {
+	case "", "local":
+		return NewLocal(cfg.LocalPath)
+	default:
+		return nil, fmt.Errorf("unsupported storage backend %q", cfg.Backend)
+	}
+}
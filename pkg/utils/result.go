@@ -11,6 +11,11 @@ const (
 	SuccessCode ResponseStatusCode = iota
 	ErrorCode
 	FailCode
+	UnauthorizedCode
+	InvalidSignatureCode  // 签名预密钥签名校验失败
+	IdentityKeyExistsCode // 设备已有不同的身份密钥，需要走替换流程
+	TooManyRequestsCode   // 失败次数过多，暂时拒绝请求
+	ForbiddenCode         // 无权限执行该操作或已被封禁
 )
 
 type Response struct {
@@ -50,6 +55,15 @@ func ErrorWithDefault(c *gin.Context) {
 	c.Abort()
 }
 
+// ErrorWithCode 使用指定状态码的错误返回，便于客户端区分具体的错误原因
+func ErrorWithCode(c *gin.Context, code ResponseStatusCode, message string) {
+	c.JSON(http.StatusOK, Response{
+		Status:  code,
+		Message: message,
+	})
+	c.Abort()
+}
+
 // Fail 失败返回
 func Fail(c *gin.Context, data interface{}, message string) {
 	c.JSON(http.StatusOK, Response{
@@ -65,3 +79,30 @@ func FailWithDefault(c *gin.Context, data interface{}) {
 	Fail(c, data, "fail")
 	c.Abort()
 }
+
+// Unauthorized 未认证返回，使用 401 状态码以便客户端触发令牌刷新
+func Unauthorized(c *gin.Context, message string) {
+	c.JSON(http.StatusUnauthorized, Response{
+		Status:  UnauthorizedCode,
+		Message: message,
+	})
+	c.Abort()
+}
+
+// TooManyRequests 请求过于频繁返回，使用 429 状态码
+func TooManyRequests(c *gin.Context, message string) {
+	c.JSON(http.StatusTooManyRequests, Response{
+		Status:  TooManyRequestsCode,
+		Message: message,
+	})
+	c.Abort()
+}
+
+// Forbidden 无权限返回，使用 403 状态码
+func Forbidden(c *gin.Context, message string) {
+	c.JSON(http.StatusForbidden, Response{
+		Status:  ForbiddenCode,
+		Message: message,
+	})
+	c.Abort()
+}